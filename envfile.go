@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/brettbuddin/ucsrename/ucs"
+)
+
+// envVars are the environment variables recognized by the program, with what each of them affects.
+var envVars = [][2]string{
+	{"UCS_CAT_ID", "CatID"},
+	{"UCS_USER_CATEGORY", "UserCategory"},
+	{"UCS_CREATOR_ID", "CreatorID"},
+	{"UCS_SOURCE_ID", "SourceID"},
+	{"UCS_USER_DATA", "UserData"},
+	{"UCS_DEFAULT_EXT", "extension of extensionless files"},
+	{"UCS_FZF_OPTS", "fzf options"},
+	{"UCS_CSV_FILE", "category file"},
+	{"UCS_CATEGORIES_FILE", "category file"},
+	{"UCS_CSV_SHA256", "category file checksum"},
+	{"UCS_USER_CATEGORY_FILE", "UserCategory file"},
+}
+
+// showEnv writes whether each recognized variable is set. Values are only included when verbose is
+// true, since they may be long or private. An empty variable is reported separately, because it
+// doesn't skip a prompt.
+func showEnv(w io.Writer, verbose bool) {
+	for _, v := range envVars {
+		fmt.Fprintf(w, "%-20s %-16s %s\n", v[0], "("+v[1]+")", envStatus(v[0], verbose))
+	}
+}
+
+// envStatus describes whether the variable key is set, including its value when verbose is true.
+func envStatus(key string, verbose bool) string {
+	value, ok := os.LookupEnv(key)
+	switch {
+	case ok && value == "":
+		return "empty"
+	case ok && verbose:
+		return fmt.Sprintf("set to %q", value)
+	case ok:
+		return "set"
+	}
+	return "not set"
+}
+
+// showContext writes the category list in use and the UCS_* variables that are set, including the
+// per-extension UCS_EXT_* defaults, for the end of the -h output. Values are only included when
+// verbose is true, as with showEnv.
+func showContext(w io.Writer, verbose bool) {
+	fmt.Fprint(w, "Current environment:\n\n")
+	fmt.Fprintf(w, "  Categories: %s\n", ucs.SourceName())
+
+	var set [][2]string
+	for _, v := range envVars {
+		if _, ok := os.LookupEnv(v[0]); ok {
+			set = append(set, v)
+		}
+	}
+	var perExt []string
+	for _, kv := range os.Environ() {
+		if key, _, _ := strings.Cut(kv, "="); strings.HasPrefix(key, "UCS_EXT_") {
+			perExt = append(perExt, key)
+		}
+	}
+	slices.Sort(perExt)
+	for _, key := range perExt {
+		set = append(set, [2]string{key, "per-extension default"})
+	}
+
+	if len(set) == 0 {
+		fmt.Fprintln(w, "  No UCS_* variables are set.")
+		return
+	}
+	for _, v := range set {
+		fmt.Fprintf(w, "  %-24s %-24s %s\n", v[0], "("+v[1]+")", envStatus(v[0], verbose))
+	}
+}
+
+// defaultEnvFile is loaded from the working directory when no -env-file is given.
+const defaultEnvFile = ".ucsrename"
+
+// envFileTemplate is the starting point written by initEnvFile. The variables are commented out so
+// that the file has no effect until they're filled in.
+const envFileTemplate = `# ucsrename settings for this session, written for UCS v%s.
+#
+# Variables here are used instead of prompting, unless they're already set in the environment.
+# Uncomment and fill in the ones that are the same for every file in the session.
+
+# Who recorded or designed the sounds (CreatorID).
+# UCS_CREATOR_ID=YourName
+
+# The library, project or session the sounds come from (SourceID).
+# UCS_SOURCE_ID=YourSession
+
+# Optional extra information appended to every name (UserData).
+# UCS_USER_DATA=
+
+# Defaults for one type of file, used when the variable above is unset (e.g. for .flac files).
+# UCS_EXT_FLAC_SOURCE_ID=YourLibrary
+
+# A custom UCS category list, instead of the builtin v%s list.
+# UCS_CSV_FILE=categories.csv
+`
+
+// initEnvFile writes a commented template to path. An existing file is only replaced when force is
+// true.
+func initEnvFile(path string, force bool) error {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if force {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	f, err := os.OpenFile(path, flags, 0o644)
+	if errors.Is(err, fs.ErrExist) {
+		return fmt.Errorf("%s already exists; use -force to overwrite it", path)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(f, envFileTemplate, ucs.Version, ucs.Version); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// loadEnvFile sets the UCS_* variables defined in the dotenv-style file at path. Variables that are
+// already set in the environment take precedence and are left untouched. A missing file is only an
+// error when required is true.
+func loadEnvFile(path string, required bool) error {
+	f, err := os.Open(path)
+	if !required && errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	vars, err := parseEnvFile(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	for _, v := range vars {
+		if _, ok := os.LookupEnv(v[0]); ok {
+			continue
+		}
+		if err := os.Setenv(v[0], v[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseEnvFile parses KEY=VALUE lines in file order. Blank lines and lines starting with "#" are
+// ignored, an "export " prefix is permitted, and values may be single or double quoted. Only UCS_*
+// variables may be set.
+func parseEnvFile(r io.Reader) ([][2]string, error) {
+	var (
+		vars [][2]string
+		line int
+	)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		text = strings.TrimPrefix(text, "export ")
+
+		key, value, ok := strings.Cut(text, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE", line)
+		}
+		key = strings.TrimSpace(key)
+		if !strings.HasPrefix(key, "UCS_") {
+			return nil, fmt.Errorf("line %d: only UCS_* variables are supported, found %s", line, key)
+		}
+		value = strings.TrimSpace(value)
+		switch {
+		case len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"':
+			unquoted, err := strconv.Unquote(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			value = unquoted
+		case len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'':
+			value = value[1 : len(value)-1]
+		}
+		vars = append(vars, [2]string{key, value})
+	}
+	return vars, scanner.Err()
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/brettbuddin/ucsrename/ucs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseEnvFile(t *testing.T) {
+	vars, err := parseEnvFile(strings.NewReader(`
+# Session defaults
+UCS_CREATOR_ID=Buddin
+export UCS_SOURCE_ID = "Phonogrifter Sessions"
+UCS_USER_DATA='close mic'
+`))
+	require.NoError(t, err)
+	require.Equal(t, [][2]string{
+		{"UCS_CREATOR_ID", "Buddin"},
+		{"UCS_SOURCE_ID", "Phonogrifter Sessions"},
+		{"UCS_USER_DATA", "close mic"},
+	}, vars)
+
+	_, err = parseEnvFile(strings.NewReader("PATH=/tmp"))
+	require.ErrorContains(t, err, "only UCS_* variables")
+
+	_, err = parseEnvFile(strings.NewReader("UCS_CREATOR_ID"))
+	require.ErrorContains(t, err, "line 1")
+}
+
+func TestLoadEnvFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), defaultEnvFile)
+	require.NoError(t, os.WriteFile(path, []byte("UCS_CREATOR_ID=FromFile\nUCS_SOURCE_ID=FromFile\n"), 0o644))
+
+	t.Setenv("UCS_CREATOR_ID", "FromEnv")
+	t.Setenv("UCS_SOURCE_ID", "")
+	require.NoError(t, os.Unsetenv("UCS_SOURCE_ID"))
+
+	require.NoError(t, loadEnvFile(path, true))
+	require.Equal(t, "FromEnv", os.Getenv("UCS_CREATOR_ID"), "environment takes precedence")
+	require.Equal(t, "FromFile", os.Getenv("UCS_SOURCE_ID"))
+
+	require.NoError(t, loadEnvFile(filepath.Join(t.TempDir(), "missing"), false))
+	require.Error(t, loadEnvFile(filepath.Join(t.TempDir(), "missing"), true))
+}
+
+func TestShowEnv(t *testing.T) {
+	for _, v := range envVars {
+		t.Setenv(v[0], "")
+		require.NoError(t, os.Unsetenv(v[0]))
+	}
+	t.Setenv("UCS_CREATOR_ID", "Buddin")
+	t.Setenv("UCS_USER_DATA", "")
+
+	var buf strings.Builder
+	showEnv(&buf, false)
+	require.Regexp(t, `UCS_CREATOR_ID +\(CreatorID\) +set\n`, buf.String())
+	require.Regexp(t, `UCS_USER_DATA +\(UserData\) +empty\n`, buf.String())
+	require.Regexp(t, `UCS_SOURCE_ID +\(SourceID\) +not set\n`, buf.String())
+	require.NotContains(t, buf.String(), "Buddin")
+
+	buf.Reset()
+	showEnv(&buf, true)
+	require.Contains(t, buf.String(), `set to "Buddin"`)
+}
+
+func TestShowContext(t *testing.T) {
+	for _, v := range envVars {
+		t.Setenv(v[0], "")
+		require.NoError(t, os.Unsetenv(v[0]))
+	}
+
+	var buf strings.Builder
+	showContext(&buf, false)
+	require.Contains(t, buf.String(), "Categories: builtin UCS v"+ucs.Version)
+	require.Contains(t, buf.String(), "No UCS_* variables are set.")
+
+	t.Setenv("UCS_CREATOR_ID", "Buddin")
+	t.Setenv("UCS_EXT_FLAC_SOURCE_ID", "Library")
+	t.Setenv("UCS_CSV_FILE", filepath.Join("ucs", "testdata", "override.csv"))
+	buf.Reset()
+	showContext(&buf, false)
+	require.Contains(t, buf.String(), "Categories: "+filepath.Join("ucs", "testdata", "override.csv")+" (from UCS_CSV_FILE)")
+	require.Regexp(t, `UCS_CREATOR_ID +\(CreatorID\) +set\n`, buf.String())
+	require.Regexp(t, `UCS_EXT_FLAC_SOURCE_ID +\(per-extension default\) +set\n`, buf.String())
+	require.NotContains(t, buf.String(), "UCS_SOURCE_ID ")
+	require.NotContains(t, buf.String(), "Buddin")
+
+	buf.Reset()
+	showContext(&buf, true)
+	require.Contains(t, buf.String(), `set to "Library"`)
+}
+
+func TestInitEnvFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), defaultEnvFile)
+	require.NoError(t, initEnvFile(path, false))
+
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Contains(t, string(b), "UCS v8.2")
+	vars, err := parseEnvFile(strings.NewReader(string(b)))
+	require.NoError(t, err)
+	require.Empty(t, vars, "placeholders are commented out")
+
+	require.ErrorContains(t, initEnvFile(path, false), "already exists")
+	require.NoError(t, initEnvFile(path, true))
+}
@@ -1,67 +1,994 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/brettbuddin/ucsrename/renamer"
 	"github.com/brettbuddin/ucsrename/ucs"
 	"github.com/mattn/go-isatty"
+	"golang.org/x/text/language"
+)
+
+// Exit codes. Help is considered a success.
+const (
+	exitSuccess = 0
+	exitFailure = 1
+	exitPartial = 2
 )
 
 func main() {
 	err := run()
-	if err == nil {
-		return
-	}
-	if errors.Is(err, flag.ErrHelp) {
-		os.Exit(2)
+	if err == nil || errors.Is(err, flag.ErrHelp) {
+		os.Exit(exitSuccess)
 	}
 	fmt.Fprintln(os.Stderr, err)
-	os.Exit(1)
-}
 
-func run() error {
-	if !isInteractive(os.Stdout) {
-		return printCategories(os.Stdout)
+	var batchErr *renamer.BatchError
+	if errors.As(err, &batchErr) && batchErr.Renamed > 0 {
+		os.Exit(exitPartial)
 	}
+	os.Exit(exitFailure)
+}
 
-	var forceConfirm bool
+func run() error {
+	var (
+		forceConfirm bool
+		set          string
+		resolveQuery string
+		tokens       bool
+		selftest     bool
+		followLinks  bool
+		quiet        bool
+		verbose      bool
+		lowerExt     bool
+		envFile      string
+		keepGoing    bool
+		defaultYes   bool
+		groupStems   bool
+		printName    bool
+		ext          string
+		preset       ucs.Filename
+		noPrompt     bool
+		reuseFXName  bool
+		exportFile   string
+		maxLength    int
+		verify       string
+		copyFiles    bool
+		linkFiles    bool
+		order        bool
+		outputDir    string
+		keepTree     bool
+		report       bool
+		reportJSON   bool
+		touch        bool
+		responses    string
+		listCats     bool
+		listUserCats bool
+		seq          int
+		showEnvVars  bool
+		renameLog    string
+		replay       string
+		extensions   string
+		sinceFlag    string
+		numbered     bool
+		byName       bool
+		catIndex     int
+		initConfig   bool
+		force        bool
+		diff         bool
+		affix        ucs.Affix
+		quietSkips   bool
+		batchExt     string
+		fromMetadata bool
+		recursive    bool
+		unifyExt     bool
+		confirmEach  bool
+		confirmOnce  bool
+		fxNameFilter string
+		bracketCat   bool
+		requiredList string
+		exportDB     string
+		cleanup      bool
+		compareFile  string
+		trim         int
+		spaceChar    string
+		parseJSON    string
+		validateName string
+		dumpFeed     bool
+		filesFrom    string
+		nulSep       bool
+		maxDepth     int
+		addCategory  bool
+		embed        bool
+		dateFlag     string
+		embedDate    time.Time
+		jobs         int
+		csvSHA256    string
+		printSHA256  bool
+	)
 	fs := flag.NewFlagSet("ucsrename", flag.ContinueOnError)
 	fs.BoolVar(&forceConfirm, "y", false, "force confirm rename")
+	fs.StringVar(&set, "set", "", "replace a single field (e.g. creator=BuddinFX) across the UCS files in a directory")
+	fs.StringVar(&resolveQuery, "resolve", "", "print the CatID best matching a search query and exit")
+	fs.BoolVar(&tokens, "tokens", false, "enter UserData as comma-separated tokens")
+	fs.StringVar(&validateName, "validate-field", "", "print the value given as an argument as it would be entered for this field (e.g. FXName), or why it's rejected, and exit")
+	fs.StringVar(&parseJSON, "parse-json", "", "print the fields of a UCS file name, with its category and any problems, as JSON and exit")
+	fs.StringVar(&compareFile, "compare-builtin", "", "report the CatIDs a custom category file adds to or drops from the builtin UCS CSV and exit")
+	fs.BoolVar(&printSHA256, "print-sha256", false, "print the SHA-256 of the category list in use, the value to pin with -csv-sha256, and exit")
+	fs.StringVar(&csvSHA256, "csv-sha256", "", "refuse to use a category file whose SHA-256 differs from this (overrides UCS_CSV_SHA256)")
+	fs.BoolVar(&selftest, "selftest", false, "verify the integrity of the builtin UCS CSV and exit")
+	fs.BoolVar(&followLinks, "follow-symlinks", false, "rename the target of a symbolic link rather than the link itself")
+	fs.BoolVar(&quiet, "q", false, "don't report progress when renaming several files")
+	fs.BoolVar(&quietSkips, "quiet-skips", false, "report a count of skipped files instead of each one")
+	fs.BoolVar(&verbose, "v", false, "report the fields of each file when renaming several files")
+	fs.BoolVar(&lowerExt, "lower-ext", false, "lowercase the file name extension")
+	fs.BoolVar(&unifyExt, "unify-ext", false, "give every extension in a batch the same case, warning when they differ")
+	fs.StringVar(&envFile, "env-file", "", "load UCS_* variables from a file (default .ucsrename, if present)")
+	fs.BoolVar(&keepGoing, "keep-going", false, "keep renaming the remaining files after one fails")
+	fs.BoolVar(&confirmEach, "confirm-each", false, "confirm each file of a batch as it's renamed (the default)")
+	fs.BoolVar(&confirmOnce, "confirm-once", false, "list every planned rename of a batch and confirm them all at once")
+	fs.BoolVar(&defaultYes, "yes-default", false, "confirm renames when the answer is left empty")
+	fs.BoolVar(&groupStems, "group-stems", false, "prompt once for files sharing a stem (e.g. foo.L.wav and foo.R.wav)")
+	fs.BoolVar(&printName, "print-name", false, "print the rendered filename instead of renaming a file")
+	fs.StringVar(&ext, "ext", "", "file name extension used with -print-name, and for files without one (overrides UCS_DEFAULT_EXT)")
+	fs.StringVar(&preset.CatID, "cat", "", "CatID to use instead of prompting (overrides UCS_CAT_ID)")
+	fs.StringVar(&preset.FXName, "fx", "", "FXName to use instead of prompting")
+	fs.StringVar(&preset.CreatorID, "creator", "", "CreatorID to use instead of prompting (overrides UCS_CREATOR_ID)")
+	fs.StringVar(&preset.SourceID, "source", "", "SourceID to use instead of prompting (overrides UCS_SOURCE_ID)")
+	fs.StringVar(&preset.UserData, "user", "", "UserData to use instead of prompting (overrides UCS_USER_DATA)")
+	fs.StringVar(&affix.Prefix, "prefix", "", "text placed before every new filename (not UCS-compliant)")
+	fs.StringVar(&affix.Suffix, "suffix", "", "text placed after every new filename, before the extension (not UCS-compliant)")
+	fs.StringVar(&filesFrom, "files-from", "", "read the files to rename from a file, one per line, or from stdin when - is given")
+	fs.BoolVar(&nulSep, "0", false, "the -files-from list is separated by NUL characters, as written by find -print0")
+	fs.StringVar(&batchExt, "batch-ext", "", "rename the files with this extension (e.g. .wav) in the directory given, asking for CatID, CreatorID and SourceID once")
+	fs.BoolVar(&recursive, "recursive", false, "rename the renamable files in directory arguments and their subdirectories")
+	fs.IntVar(&maxDepth, "max-depth", -1, "with -recursive, descend at most this many directory levels (0 renames only the files in the directory itself)")
+	fs.BoolVar(&fromMetadata, "from-metadata", false, "pre-fill FXName and CreatorID from the bext, LIST INFO and iXML chunks of WAV files")
+	fs.StringVar(&fxNameFilter, "fxname-filter", "", "command that each FXName is piped through, such as a house-style normalizer")
+	fs.BoolVar(&reuseFXName, "reuse-fxname", false, "reuse the previous FXName when its answer is left empty, adding a take number to UserData")
+	fs.BoolVar(&order, "order", false, "start the UserData of each file with its zero-padded position in the batch, sorted by path")
+	fs.IntVar(&seq, "seq", 0, "prompt once for several files and number their FXNames, starting at this number")
+	fs.StringVar(&exportFile, "export", "", "write the loaded categories to a CSV file and exit")
+	fs.StringVar(&spaceChar, "space-char", "-", "character that replaces spaces within a field; empty removes them")
+	fs.IntVar(&trim, "trim", 0, "truncate UserData to this many characters, at a word boundary where possible")
+	fs.IntVar(&maxLength, "max-len", 0, "maximum length of the new filename in bytes, shown while entering FXName (0 means no limit)")
+	fs.BoolVar(&copyFiles, "copy", false, "copy files to their new names, leaving the originals in place")
+	fs.BoolVar(&report, "report", false, "summarize the CreatorIDs, SourceIDs and CatShorts used once a batch is renamed")
+	fs.BoolVar(&reportJSON, "json", false, "write the -report summary as JSON")
+	fs.StringVar(&outputDir, "o", "", "move renamed files into this directory, which is created if needed")
+	fs.BoolVar(&keepTree, "keep-structure", false, "with -o, recreate each file's folder, relative to the working directory, under the output directory")
+	fs.BoolVar(&linkFiles, "link", false, "create hardlinks at the new names, leaving the originals in place")
+	fs.BoolVar(&cleanup, "cleanup", false, "remove partial copies left by interrupted -copy runs before renaming")
+	fs.BoolVar(&touch, "touch", false, "set the modification time of renamed or copied files to now")
+	fs.IntVar(&jobs, "jobs", 1, "number of files copied, embedded or moved into -o at once, once a batch is confirmed")
+	fs.BoolVar(&embed, "embed", false, "write the BWF origination date and time of renamed WAV files from their modification time")
+	fs.StringVar(&dateFlag, "date", "", "origination date written by -embed instead of the modification time (2024-05-01, 2024-05-01T10:00:00Z)")
+	fs.StringVar(&responses, "responses", "", "read answers to the field prompts from a file, one per line")
+	fs.StringVar(&exportDB, "export-db", "", "write a Soundminer-compatible metadata CSV describing each renamed file")
+	fs.StringVar(&renameLog, "rename-log", "", "append a JSON line recording each rename to a file, for use with -replay")
+	fs.StringVar(&replay, "replay", "", "rename the files in a directory using the fields recorded in a rename log")
+	fs.StringVar(&extensions, "extensions", "", "comma-separated extensions of the files matched by patterns and directories (default "+strings.Join(renamer.DefaultExtensions, ",")+")")
+	fs.StringVar(&sinceFlag, "since", "", "only rename files matched by patterns that were modified after a time (2024-05-01, 2024-05-01T10:00:00Z) or within a duration (e.g. 2h)")
+	fs.BoolVar(&diff, "diff", false, "preview -set changes as aligned names with the changed portion marked")
+	fs.StringVar(&verify, "verify", "", "check that a directory contains exactly the files named by a manifest CSV and exit")
+	fs.StringVar(&requiredList, "required", "", "comma-separated fields that must be given (default cat,fx,creator,source); others may be left empty")
+	fs.BoolVar(&noPrompt, "no-prompt", false, "never prompt; fail if a required field isn't provided by a flag or the environment")
+	fs.BoolVar(&showEnvVars, "show-env", false, "report which UCS_* variables are set (with their values when -v is given) and exit")
+	fs.BoolVar(&listCats, "list-categories", false, "print the category list fed to fzf and exit")
+	fs.BoolVar(&dumpFeed, "dump-feed", false, "print the category list fed to fzf, reporting how fzf is run and any lines that won't select their CatID on stderr, and exit")
+	fs.BoolVar(&addCategory, "add-category", false, "prompt for a new category, append it to the custom CSV file named by UCS_CSV_FILE, and exit")
+	fs.BoolVar(&bracketCat, "bracket-user-category", false, "render the UserCategory in brackets ahead of the CatID (e.g. [Dusk]AMBPark_...)")
+	fs.BoolVar(&listUserCats, "list-user-categories", false, "print the UserCategory list fed to fzf and exit")
+	fs.BoolVar(&numbered, "numbered", false, "number the categories printed by -list-categories, for use with -cat-index")
+	fs.BoolVar(&byName, "by-name", false, "order the -list-categories -numbered listing by Category and SubCategory, collated for the locale")
+	fs.IntVar(&catIndex, "cat-index", 0, "select the CatID by its number in the -list-categories -numbered listing")
+	fs.BoolVar(&initConfig, "init", false, "write a commented .ucsrename (or -env-file) template for a new session and exit")
+	fs.BoolVar(&force, "force", false, "overwrite an existing file with -init")
 	fs.Usage = usageFn(fs)
-	if err := fs.Parse(os.Args[1:]); err != nil {
+	args, err := expandSubcommand(os.Args[1:])
+	if err != nil {
+		return err
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if initConfig {
+		path := defaultEnvFile
+		if envFile != "" {
+			path = envFile
+		}
+		return initEnvFile(path, force)
+	}
+	if envFile != "" {
+		if err := loadEnvFile(envFile, true); err != nil {
+			return err
+		}
+	} else if err := loadEnvFile(defaultEnvFile, false); err != nil {
+		return err
+	}
+	if csvSHA256 != "" {
+		os.Setenv("UCS_CSV_SHA256", csvSHA256)
+	}
+	if printSHA256 {
+		// Printed alone, so that it can be captured before pinning it.
+		_, sum, err := ucs.Checksum()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(os.Stdout, sum)
+		return nil
+	}
+
+	if showEnvVars {
+		showEnv(os.Stdout, verbose)
+		return nil
+	}
+	if compareFile != "" {
+		return compareBuiltin(os.Stdout, compareFile)
+	}
+	if selftest {
+		if err := ucs.CheckBuiltin(); err != nil {
+			return err
+		}
+		fmt.Fprintln(os.Stdout, "OK")
+		return nil
+	}
+	if exportFile != "" {
+		return exportCategories(exportFile)
+	}
+	if listCats {
+		if numbered || byName {
+			return printCategories(os.Stdout, byName)
+		}
+		return ucs.WriteFeed(os.Stdout)
+	}
+	if listUserCats {
+		list, err := ucs.UserCategories()
+		if err != nil {
+			return err
+		}
+		return ucs.WriteUserCategoryFeed(os.Stdout, list)
+	}
+	if catIndex != 0 {
+		if preset.CatID != "" {
+			return fmt.Errorf("-cat and -cat-index can't be combined")
+		}
+		catID, err := catIDAt(catIndex)
+		if err != nil {
+			return err
+		}
+		preset.CatID = catID
+	}
+	if resolveQuery != "" {
+		return resolve(os.Stdout, resolveQuery)
+	}
+	var logFile *os.File
+	if renameLog != "" {
+		f, err := os.OpenFile(renameLog, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		logFile = f
+	}
+	var dbFile *os.File
+	if exportDB != "" {
+		f, err := os.Create(exportDB)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if err := renamer.WriteDatabaseHeader(f); err != nil {
+			return err
+		}
+		dbFile = f
+	}
+	var allowlist []string
+	for _, ext := range strings.Split(extensions, ",") {
+		if ext = strings.TrimSpace(ext); ext != "" {
+			allowlist = append(allowlist, ext)
+		}
+	}
+	if err := affix.Validate(); err != nil {
 		return err
 	}
+	if affix != (ucs.Affix{}) {
+		fmt.Fprintln(os.Stderr, "Warning: -prefix and -suffix produce names that don't follow the UCS standard")
+	}
+	var required []string
+	if requiredList != "" {
+		var err error
+		if required, err = ucs.ParseRequired(requiredList); err != nil {
+			return fmt.Errorf("invalid -required value: %w", err)
+		}
+	}
+	if err := ucs.ValidateSpaceChar(spaceChar); err != nil {
+		return fmt.Errorf("-space-char: %w", err)
+	}
+	newRenamer := func() (renamer.Renamer, error) {
+		r, err := renamer.NewDefault()
+		if err != nil {
+			return r, err
+		}
+		r.UserDataTokens = tokens
+		r.FollowSymlinks = followLinks
+		r.Quiet = quiet
+		r.Verbose = verbose
+		r.QuietSkips = quietSkips
+		r.LowerExt = lowerExt
+		r.UnifyExt = unifyExt
+		r.KeepGoing = keepGoing
+		r.DefaultYes = defaultYes
+		r.ConfirmOnce = confirmOnce
+		r.GroupStems = groupStems
+		r.Preset = preset
+		r.NoPrompt = noPrompt
+		r.ReuseFXName = reuseFXName
+		r.FXNameFilter = fxNameFilter
+		r.BracketUserCategory = bracketCat
+		r.Required = required
+		r.TrimUserData = trim
+		if ext != "" {
+			r.DefaultExt = ext
+		}
+		r.SpaceChar = spaceChar
+		r.RemoveSpaces = spaceChar == ""
+		r.FromMetadata = fromMetadata
+		r.Sequence = seq
+		r.OrderUserData = order
+		r.Interactive = isInteractive(os.Stdin)
+		r.MaxLength = maxLength
+		r.Copy = copyFiles
+		r.Link = linkFiles
+		r.OutputDir = outputDir
+		r.KeepStructure = keepTree
+		r.Report = report
+		r.ReportJSON = reportJSON
+		r.Touch = touch
+		r.Embed = embed
+		r.EmbedDate = embedDate
+		r.Jobs = jobs
+		r.Extensions = allowlist
+		r.Diff = diff
+		r.ShareFields = batchExt != "" || filesFrom != ""
+		r.Affix = affix
+		if logFile != nil {
+			r.Log = logFile
+		}
+		if dbFile != nil {
+			r.Database = dbFile
+		}
+		if responses != "" {
+			b, err := os.ReadFile(responses)
+			if err != nil {
+				return r, err
+			}
+			r.Responses = bytes.NewReader(b)
+		}
+		return r, nil
+	}
+
+	if parseJSON != "" {
+		return printParsed(os.Stdout, parseJSON, affix)
+	}
+	if dumpFeed {
+		r, err := newRenamer()
+		if err != nil {
+			return err
+		}
+		return r.DumpFeed(os.Stdout)
+	}
+	if addCategory {
+		r, err := newRenamer()
+		if err != nil {
+			return err
+		}
+		return r.AddCategory()
+	}
+	if validateName != "" {
+		if fs.NArg() != 1 {
+			return fmt.Errorf("-validate-field requires a single value argument")
+		}
+		return validateField(os.Stdout, validateName, fs.Arg(0), spaceChar, required)
+	}
+	if printName {
+		r, err := newRenamer()
+		if err != nil {
+			return err
+		}
+		// Prompts go to stderr so that the name can be captured from stdout.
+		r.Stdout = os.Stderr
+		return r.PrintName(os.Stdout, ext)
+	}
+	if verify != "" {
+		if fs.NArg() != 1 {
+			return fmt.Errorf("-verify requires a single directory argument")
+		}
+		r, err := newRenamer()
+		if err != nil {
+			return err
+		}
+		return verifyManifest(r, verify, fs.Arg(0))
+	}
+	if replay != "" {
+		if fs.NArg() != 1 {
+			return fmt.Errorf("-replay requires a single directory argument")
+		}
+		r, err := newRenamer()
+		if err != nil {
+			return err
+		}
+		return replayLog(r, replay, fs.Arg(0), forceConfirm)
+	}
+	if confirmEach && confirmOnce {
+		return fmt.Errorf("-confirm-each and -confirm-once can't be combined")
+	}
+	if reportJSON && !report {
+		return fmt.Errorf("-json requires -report")
+	}
+	if keepTree && outputDir == "" {
+		return fmt.Errorf("-keep-structure requires -o")
+	}
+	if copyFiles && linkFiles {
+		return fmt.Errorf("-copy and -link can't be combined")
+	}
+	if linkFiles && touch {
+		return fmt.Errorf("-link and -touch can't be combined, because a hardlink shares the original's modification time")
+	}
+	if jobs < 1 {
+		return fmt.Errorf("-jobs must be at least 1")
+	}
+	if linkFiles && embed {
+		return fmt.Errorf("-link and -embed can't be combined, because a hardlink shares the original's contents")
+	}
+	if dateFlag != "" {
+		if !embed {
+			return fmt.Errorf("-date requires -embed")
+		}
+		var err error
+		if embedDate, err = parseEmbedDate(dateFlag); err != nil {
+			return err
+		}
+	}
+	if filesFrom != "" && fs.NArg() > 0 {
+		return fmt.Errorf("-files-from can't be combined with file arguments")
+	}
+	if filesFrom == "-" {
+		if !forceConfirm {
+			return fmt.Errorf("-files-from - requires -y, because stdin holds the file list and can't answer prompts")
+		}
+		// The fields must come from flags or the environment.
+		noPrompt = true
+	}
+	if noPrompt && !forceConfirm {
+		return fmt.Errorf("-no-prompt requires -y, because confirming a rename is a prompt")
+	}
 
-	filename := fs.Arg(0)
-	if filename == "" {
+	if cleanup {
+		if err := cleanupTemp(fs.Args()); err != nil {
+			return err
+		}
+	}
+	if fs.NArg() == 0 && filesFrom == "" {
+		if cleanup {
+			return nil
+		}
 		fs.Usage()
 		return nil
 	}
-	r, err := renamer.NewDefault()
+	var since time.Time
+	if sinceFlag != "" {
+		var err error
+		if since, err = parseSince(sinceFlag, time.Now()); err != nil {
+			return err
+		}
+	}
+	filenames, err := expandGlobs(fs.Args(), allowlist, since)
+	if err != nil {
+		return err
+	}
+	if filesFrom != "" {
+		if filenames, err = readFileList(filesFrom, nulSep); err != nil {
+			return err
+		}
+	}
+	if recursive {
+		if filenames, err = walkDirs(filenames, allowlist, since, maxDepth); err != nil {
+			return err
+		}
+	}
+	if batchExt != "" {
+		if len(filenames) != 1 {
+			return fmt.Errorf("-batch-ext requires a single directory argument")
+		}
+		if filenames, err = filesWithExt(filenames[0], batchExt); err != nil {
+			return err
+		}
+	}
+	r, err := newRenamer()
 	if err != nil {
 		return err
 	}
-	return r.Run(filename, forceConfirm)
+	if set != "" {
+		field, value, ok := strings.Cut(set, "=")
+		if !ok {
+			return fmt.Errorf("invalid -set value %q: expected field=value", set)
+		}
+		if len(filenames) != 1 {
+			return fmt.Errorf("-set requires a single directory argument")
+		}
+		return r.SetField(filenames[0], field, value, forceConfirm)
+	}
+	return r.RunAll(filenames, forceConfirm)
 }
 
-func isInteractive(stdout *os.File) bool {
-	return isatty.IsTerminal(stdout.Fd())
+// expandGlobs expands arguments containing glob metacharacters, so patterns behave the same
+// regardless of the shell. Arguments naming an existing file are left untouched, even if they
+// contain metacharacters. Matches that aren't renamable according to allowlist, or that were last
+// modified before since, are dropped.
+func expandGlobs(args []string, allowlist []string, since time.Time) ([]string, error) {
+	var filenames []string
+	for _, arg := range args {
+		if !strings.ContainsAny(arg, "*?[") {
+			filenames = append(filenames, arg)
+			continue
+		}
+		if _, err := os.Lstat(arg); err == nil {
+			filenames = append(filenames, arg)
+			continue
+		}
+		matches, err := filepath.Glob(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", arg, err)
+		}
+		matches = slices.DeleteFunc(matches, func(m string) bool {
+			return !renamer.IsRenamable(m, allowlist) || !modifiedSince(m, since)
+		})
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no renamable files match %q", arg)
+		}
+		filenames = append(filenames, matches...)
+	}
+	return filenames, nil
+}
+
+// readFileList reads the list of files to rename from path, or from stdin when path is "-". Names are
+// separated by newlines, or by NUL characters when nul is true, which is the only safe choice for
+// names that may contain newlines. Empty names are ignored.
+func readFileList(path string, nul bool) ([]string, error) {
+	var b []byte
+	var err error
+	if path == "-" {
+		b, err = io.ReadAll(os.Stdin)
+	} else {
+		b, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return splitFileList(string(b), nul)
+}
+
+// splitFileList splits a file list read by readFileList into names.
+func splitFileList(list string, nul bool) ([]string, error) {
+	sep := "\n"
+	if nul {
+		sep = "\x00"
+	}
+	var names []string
+	for _, name := range strings.Split(list, sep) {
+		if !nul {
+			name = strings.TrimSuffix(name, "\r")
+		}
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("the file list is empty")
+	}
+	return names, nil
+}
+
+// cleanupTemp removes the partial copies left in the directories of args by interrupted copies. Each
+// argument is either a directory or a file, whose directory is cleaned. The working directory is
+// cleaned when there are no arguments.
+func cleanupTemp(args []string) error {
+	if len(args) == 0 {
+		args = []string{"."}
+	}
+	var dirs []string
+	for _, arg := range args {
+		dir := filepath.Dir(arg)
+		if info, err := os.Stat(arg); err == nil && info.IsDir() {
+			dir = arg
+		}
+		if !slices.Contains(dirs, dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+	for _, dir := range dirs {
+		removed, err := renamer.CleanupTemp(dir)
+		for _, path := range removed {
+			fmt.Fprintf(os.Stderr, "Removed %s\n", path)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// modifiedSince reports whether the file at path was last modified at or after since. Every file is
+// when since is zero.
+func modifiedSince(path string, since time.Time) bool {
+	if since.IsZero() {
+		return true
+	}
+	info, err := os.Stat(path)
+	return err == nil && !info.ModTime().Before(since)
+}
+
+// walkDirs replaces the directories among filenames with the renamable files found by walking them,
+// in lexical order. Hidden directories aren't entered, and neither are directories more than
+// maxDepth levels below the one given, unless maxDepth is negative. Files are filtered like pattern
+// matches are by expandGlobs.
+func walkDirs(filenames []string, allowlist []string, since time.Time, maxDepth int) ([]string, error) {
+	var walked []string
+	for _, name := range filenames {
+		info, err := os.Stat(name)
+		if err != nil || !info.IsDir() {
+			walked = append(walked, name)
+			continue
+		}
+		found := 0
+		err = filepath.WalkDir(name, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(name, path)
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				if rel == "." {
+					return nil
+				}
+				depth := strings.Count(rel, string(filepath.Separator)) + 1
+				if strings.HasPrefix(d.Name(), ".") || (maxDepth >= 0 && depth > maxDepth) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.Type().IsRegular() && renamer.IsRenamable(path, allowlist) && modifiedSince(path, since) {
+				walked = append(walked, path)
+				found++
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if found == 0 {
+			return nil, fmt.Errorf("no renamable files in %s", name)
+		}
+	}
+	return walked, nil
+}
+
+// filesWithExt lists the files in dir, without descending into subdirectories, that have the
+// extension ext.
+func filesWithExt(dir, ext string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var filenames []string
+	for _, e := range entries {
+		if e.Type().IsRegular() && renamer.IsRenamable(e.Name(), []string{ext}) {
+			filenames = append(filenames, filepath.Join(dir, e.Name()))
+		}
+	}
+	if len(filenames) == 0 {
+		return nil, fmt.Errorf("%s contains no %s files", dir, ext)
+	}
+	return filenames, nil
+}
+
+// parseSince parses the -since flag, which is either a duration before now or a point in time given
+// as an RFC 3339 timestamp or a date.
+func parseSince(s string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid -since value %q: expected a duration (e.g. 2h) or a time (e.g. 2024-05-01)", s)
+}
+
+// expandSubcommand rewrites a leading subcommand into the flags it stands for, so that the rest of
+// the arguments are parsed just as they would be without it. Arguments that don't start with a
+// subcommand are returned as they are.
+func expandSubcommand(args []string) ([]string, error) {
+	if len(args) == 0 {
+		return args, nil
+	}
+	rest := args[1:]
+	switch args[0] {
+	case "rename":
+		return rest, nil
+	case "list":
+		return append([]string{"-list-categories"}, rest...), nil
+	case "check":
+		return append([]string{"-selftest"}, rest...), nil
+	case "diff":
+		// The category file comes last, after any flags.
+		if len(rest) == 0 || strings.HasPrefix(rest[len(rest)-1], "-") {
+			return nil, fmt.Errorf("diff requires a category file to compare with the builtin UCS CSV")
+		}
+		expanded := append(slices.Clone(rest[:len(rest)-1]), "-compare-builtin", rest[len(rest)-1])
+		return expanded, nil
+	}
+	return args, nil
+}
+
+// parseEmbedDate parses the -date flag, an RFC 3339 timestamp or a date with an optional time. Times
+// without a zone are taken to be UTC, which is how they're written.
+func parseEmbedDate(s string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.UTC); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid -date value %q: expected a date (e.g. 2024-05-01) or a time (e.g. 2024-05-01T10:00:00Z)", s)
+}
+
+// parsed is the JSON form of a file name parsed by -parse-json.
+type parsed struct {
+	File      string            `json:"file"`
+	Valid     bool              `json:"valid"`
+	Issues    []string          `json:"issues"`
+	Extension string            `json:"extension,omitempty"`
+	Filename  *ucs.FilenameJSON `json:"filename,omitempty"`
+}
+
+// printParsed writes the fields of the UCS name of path as JSON, with the category its CatID refers
+// to. A name that doesn't parse, or whose CatID is unknown, is reported as invalid with the issues
+// found, rather than as an error.
+func printParsed(w io.Writer, path string, affix ucs.Affix) error {
+	result := parsed{File: path, Issues: []string{}}
+	f, ext, err := affix.Parse(filepath.Base(path))
+	if err != nil {
+		result.Issues = append(result.Issues, err.Error())
+	} else {
+		index, err := ucs.LoadIndex()
+		if err != nil {
+			return err
+		}
+		if c, ok := index.Lookup(f.CatID); ok {
+			f.Category = &c
+		} else {
+			result.Issues = append(result.Issues, fmt.Sprintf("unknown CatID %q", f.CatID))
+		}
+		fj := f.WithCategory()
+		result.Filename = &fj
+		result.Extension = ext
+	}
+	result.Valid = len(result.Issues) == 0
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(result)
+}
+
+// validateField writes value as it would be entered for field: sanitized, with spaces replaced by
+// space, and for a CatID, cased as in the catalog. A value that would be rejected is an error, so
+// wrappers can check their input without a file to rename. required is as for Renamer.Required.
+func validateField(w io.Writer, field, value, space string, required []string) error {
+	name, ok := ucs.FieldName(field)
+	if !ok {
+		return fmt.Errorf("unknown field: %s", field)
+	}
+	sanitized, err := ucs.SanitizeSegmentWith(value, space)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	if len(required) == 0 {
+		required = ucs.DefaultRequired
+	}
+	switch {
+	case sanitized == "" && slices.Contains(required, name):
+		return fmt.Errorf("%s is required", name)
+	case sanitized != "" && name == "CatID":
+		index, err := ucs.LoadIndex()
+		if err != nil {
+			return err
+		}
+		canonical, ok := index.Canonical(sanitized)
+		if !ok {
+			return fmt.Errorf("unknown CatID %q", sanitized)
+		}
+		sanitized = canonical
+	}
+	_, err = fmt.Fprintln(w, sanitized)
+	return err
+}
+
+func verifyManifest(r renamer.Renamer, manifest, dir string) error {
+	f, err := os.Open(manifest)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	entries, err := renamer.ReadManifest(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", manifest, err)
+	}
+	return r.Verify(entries, dir)
 }
 
-func printCategories(w io.Writer) error {
+func replayLog(r renamer.Renamer, log, dir string, forceConfirm bool) error {
+	f, err := os.Open(log)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	entries, err := renamer.ReadLog(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", log, err)
+	}
+	return r.Replay(entries, dir, forceConfirm)
+}
+
+func isInteractive(f *os.File) bool {
+	return isatty.IsTerminal(f.Fd())
+}
+
+// printCategories writes a numbered line for each category, sorted by CatID, or by Category and
+// SubCategory in the collation order of the locale when byName is set. The number is the first
+// field of the line, so scripts can read it back, and is the 1-based position accepted by catIDAt
+// in either order. The list fed to fzf is written by ucs.WriteFeed instead.
+func printCategories(w io.Writer, byName bool) error {
 	categories, err := ucs.Categories()
 	if err != nil {
 		return err
 	}
 
+	numbers := map[string]int{}
+	for i, c := range categories {
+		if _, ok := numbers[c.CatID]; !ok {
+			numbers[c.CatID] = i + 1
+		}
+	}
+	if byName {
+		categories = slices.Clone(categories)
+		ucs.SortByName(categories, collationTag())
+	}
+
 	for _, c := range categories {
-		fmt.Fprintf(w, "%s: %s %s -- %s\n", c.CatID, c.Category, c.SubCategory, c.Synonyms)
+		fmt.Fprintf(w, "%4d  %s: %s %s -- %s", numbers[c.CatID], c.CatID, c.Category, c.SubCategory, c.Synonyms)
+		if len(c.Aliases) > 0 {
+			fmt.Fprintf(w, " (aliases: %s)", strings.Join(c.Aliases, ", "))
+		}
+		fmt.Fprintln(w)
+	}
+	return nil
+}
+
+// collationTag returns the language whose collation rules -by-name follows, taken from the locale
+// in LC_ALL, LC_COLLATE or LANG, in that order. language.Und, which follows the root collation
+// rules, is returned when none is set or the locale can't be parsed.
+func collationTag() language.Tag {
+	for _, key := range []string{"LC_ALL", "LC_COLLATE", "LANG"} {
+		locale := os.Getenv(key)
+		if locale == "" {
+			continue
+		}
+		// Locales look like fr_FR.UTF-8 or de_DE@euro.
+		locale, _, _ = strings.Cut(locale, ".")
+		locale, _, _ = strings.Cut(locale, "@")
+		tag, err := language.Parse(strings.ReplaceAll(locale, "_", "-"))
+		if err != nil {
+			return language.Und
+		}
+		return tag
+	}
+	return language.Und
+}
+
+// catIDAt returns the CatID at the 1-based position n of the sorted category list. The numbering
+// matches printCategories, and is stable as long as the categories don't change.
+func catIDAt(n int) (string, error) {
+	categories, err := ucs.Categories()
+	if err != nil {
+		return "", err
+	}
+	if n < 1 || n > len(categories) {
+		return "", fmt.Errorf("invalid -cat-index %d: expected a number from 1 to %d", n, len(categories))
+	}
+	return categories[n-1].CatID, nil
+}
+
+// exportCategories writes the loaded categories to path in the canonical UCS CSV format, preserving
+// the order of the datasource.
+func exportCategories(path string) error {
+	categories, err := ucs.CategoriesUnsorted()
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := ucs.WriteCSV(f, categories); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// compareBuiltin writes the CatIDs that the category file at path adds to, and drops from, the builtin
+// UCS CSV, followed by a count of each.
+func compareBuiltin(w io.Writer, path string) error {
+	builtin, err := ucs.BuiltinCategories()
+	if err != nil {
+		return err
+	}
+	custom, err := ucs.CategoriesFile(path)
+	if err != nil {
+		return err
+	}
+	d := ucs.Diff(builtin, custom)
+	for _, c := range d.Added {
+		fmt.Fprintf(w, "+ %-12s %s %s\n", c.CatID, c.Category, c.SubCategory)
+	}
+	for _, c := range d.Removed {
+		fmt.Fprintf(w, "- %-12s %s %s\n", c.CatID, c.Category, c.SubCategory)
+	}
+	fmt.Fprintf(w, "%d added, %d removed\n", len(d.Added), len(d.Removed))
+	return nil
+}
+
+// resolve prints the CatID that best matches query. It's an error for the query to match nothing, or
+// for several categories to match equally well.
+func resolve(w io.Writer, query string) error {
+	matches, err := ucs.Search(query)
+	if err != nil {
+		return err
+	}
+	if len(matches) == 0 {
+		return fmt.Errorf("no categories match %q", query)
 	}
+
+	best := matches[0].Score
+	var candidates []string
+	for _, m := range matches {
+		if m.Score < best {
+			break
+		}
+		candidates = append(candidates, m.Category.CatID)
+	}
+	if len(candidates) > 1 {
+		return fmt.Errorf("%q is ambiguous; candidates: %s", query, strings.Join(candidates, ", "))
+	}
+
+	fmt.Fprintln(w, candidates[0])
 	return nil
 }
 
@@ -70,18 +997,179 @@ ucsrename renames files using Universal Category System (UCS) filename pattern.
 
 Usage:
 	
-	ucsrename [-y] filename.wav
+	ucsrename [-y] filename.wav...
+	ucsrename [-y] -set field=value directory
+	ucsrename -print-name [-ext .wav]
+	ucsrename -resolve query
+	ucsrename -verify manifest.csv directory
+	ucsrename [-y] -replay rename.log directory
+
+The most common modes can also be chosen with a subcommand ahead of the flags, which are the same as
+without one. A first argument that isn't a subcommand is a file to rename, as before; to rename a
+file that's named after a subcommand, use "ucsrename rename list" or "./list".
+
+	ucsrename rename [-y] filename.wav...   the same as leaving out "rename"
+	ucsrename list [-numbered] [-by-name]   -list-categories
+	ucsrename check                         -selftest
+	ucsrename diff custom.csv               -compare-builtin custom.csv
 
 The program asks a series of questions to build a filename that conforms to UCS standards. The
-source file's file extension is carried forward to the new file. Here's the layout of the filename
-that it produces:
+source file's file extension is carried forward to the new file (lowercased with -lower-ext). When
+files from different recorders mix .wav and .WAV, -unify-ext gives every extension in a batch the
+case most of them use (or lowercase, with -lower-ext) and warns about the mix. Here's the layout of
+the filename that it produces:
 
 	CatID_FXName_CreatorID_SourceID_UserData.Extention
 
+Each rename is confirmed before it happens, unless -y is given. Pressing Enter at the confirmation
+answers no, or yes with -yes-default; the prompt shows the default as (y/N) or (Y/n).
+
+When several files are renamed, each one is confirmed as it's renamed (-confirm-each). With
+-confirm-once, every planned rename is listed instead and confirmed with a single answer; answering
+no leaves every file untouched, so it doubles as a dry run of the batch. -y skips confirmation
+altogether, as if the plan were confirmed once.
+
+With -report, a batch ends with a summary on stderr of how many files use each CreatorID, SourceID
+and CatShort, with a warning for values that differ only in case, such as two spellings of a
+CreatorID. -json writes the summary as JSON instead.
+
+Multiple files can be given. The fields of every file are gathered first, and if two files would be
+given the same name the conflict is reported and nothing is renamed. Progress is reported on stderr
+as each file is renamed, e.g. [3/12] AMBPark_Fountain_Buddin_Phonogrifter.wav; -q silences it and -v
+adds the individual fields. -quiet-skips replaces the message for each skipped file with a count at
+the end, which keeps re-runs over a mostly renamed library readable. Renaming stops at the first
+file that fails, unless -keep-going is given. Glob patterns are expanded by the program itself when
+quoted (e.g. ucsrename '*.wav'), so they behave the same regardless of the shell. Files matched by a
+pattern are only renamed if they have one of the extensions given with -extensions (by default
+common audio formats such as .wav, .aif and .flac), which keeps hidden files like .DS_Store and
+notes from being swept up. Files named explicitly are always renamed. Likewise, -since skips files
+matched by a pattern that haven't been modified since a time or within a duration, so a growing
+session folder can be renamed repeatedly without touching earlier captures:
+
+	ucsrename -since 2h '*.wav'
+	ucsrename -since 2024-05-01 'session/*.wav'
+
+With -recursive, directories given as arguments are walked and the files found in them and their
+subdirectories are renamed, filtered like pattern matches. Hidden directories are skipped.
+-max-depth limits how many levels below each directory are entered; 0 renames only the files in the
+directory itself, which keeps nested bounce and render folders out of the way:
+
+	ucsrename -recursive -max-depth 1 session/
+
+Answers can also be read from a file with -responses, one per line in the order the questions are
+asked (FXName, CreatorID, SourceID, UserData), skipping any provided by flags or the environment.
+A blank line leaves UserData empty. An invalid answer is an error rather than being asked again.
+The CatID is still selected with fzf unless -cat or UCS_CAT_ID provides it:
+
+	ucsrename -cat AMBPark -responses answers.txt fountain.wav
+
+Studio style guides can be enforced with -fxname-filter, naming a command that each FXName is piped
+through once it's been sanitized. Its output, sanitized again, becomes the FXName. A filter that
+exits with an error aborts the rename and its error output is shown. The command isn't run by a
+shell, but may include quoted arguments:
+
+	ucsrename -fxname-filter "house-style --titlecase" fountain.wav
+
+CatID, FXName, CreatorID and SourceID are required by default, as the UCS standard requires them.
+Pipelines that treat some of them as optional can name the fields to require with -required, using
+the same names as -set; CatID and FXName are always required. The others may then be left empty.
+Empty fields at the end drop out of the filename like UserData, so -required cat,fx,creator can
+produce AMBPark_Fountain_Buddin.wav, while an empty field before one that's given keeps its place,
+as in AMBPark_Fountain__Phono_close.wav. Such names don't follow the UCS standard, and aren't
+recognized as UCS names by -set or -verify:
+
+	ucsrename -required cat,fx,creator fountain.wav
+
+With -reuse-fxname, leaving FXName empty reuses the FXName of the previous file, which is handy for
+a run of takes of the same sound. Each reuse appends a take number (take2, take3, ...) to UserData.
+
+A folder of recordings can be renamed with -batch-ext, which renames the files with one extension
+in a directory, without descending into subdirectories. CatID, CreatorID and SourceID are asked for
+once and reused for every file, leaving FXName and UserData to be answered per file:
+
+	ucsrename -batch-ext .wav session/
+
+The files to rename can also be listed in a file with -files-from, one per line, or NUL-separated
+with -0. Like -batch-ext, CatID, CreatorID and SourceID are asked for once. When the list is read
+from stdin with -files-from -, stdin can't answer prompts, so -y is required and every field must
+come from flags or the environment:
+
+	find session -name '*.wav' -print0 | ucsrename -files-from - -0 -y -cat DSGNMisc -fx Hit
+
+Files that already carry partial metadata from the recorder can be named with -from-metadata. The
+FXName is taken from the iXML USER FXNAME or NOTE, the LIST INFO INAM (title) or the bext
+Description, in that order, and the CreatorID from the iXML USER CREATORID or DESIGNER, the LIST
+INFO IART (artist) or the bext Originator. Only the fields that are missing are prompted for.
+Embedded values take precedence over the environment, but not over flags such as -creator. Files
+whose metadata can't be read are prompted for as usual, with a warning.
+
+Many DAWs rely on the BWF origination date and time, which -embed writes into the bext chunk of each
+renamed WAV file, adding the chunk if there isn't one. They're taken from the file's modification
+time, which is left as it was, or from -date. Both are written in UTC, as YYYY-MM-DD and HH:MM:SS;
+a -date without a zone is taken to be UTC:
+
+	ucsrename -embed -date 2024-05-01T10:30:00Z fountain.wav
+
+For a run of captures of the same sound, -seq prompts for the fields once and numbers the FXName of
+each file, starting from the number given. The numbers are zero-padded to the same width so the
+names sort naturally; ten door slams renamed with -seq 1 become Door-Slam-01 through Door-Slam-10.
+
+To keep the play order of a folder of different sounds, -order numbers each file by its position in
+the batch sorted by path, and puts the number first in its UserData, zero-padded to the width of the
+batch size: the third of twelve files gets 03, or 03-close when its UserData is close.
+
+-print-name asks the same questions but prints the resulting filename instead of renaming a file,
+which is useful for planning names ahead of time. The extension is given with -ext. The questions
+are written to stderr, so the name can be captured:
+
+	name=$(ucsrename -print-name -ext .wav)
+
+With -group-stems, files sharing a stem, such as foo.wav, foo.L.wav and foo.R.wav, are named
+together: the fields are prompted once and the part of each name following the stem (L and R) is
+appended to its UserData.
+
+With -copy, files are copied to their new names and the originals are left in place. The access and
+modification times of the original, which often record when a sound was captured, are carried over
+to the copy, just as they are by a rename. -touch sets the modification time to now instead. Each
+copy is written under a temporary name ending in .ucsrename.tmp and only renamed into place once
+it's complete, so an interrupted copy never leaves a partial file under the new name. -cleanup
+removes such leftovers from the directories of the files given (or the working directory) first.
+
+Large batches of copies are I/O bound, and -jobs spreads them over several files at once. It also
+applies to -embed and to moves into -o, but not to plain renames, which are cheap. The fields are
+still prompted for one file at a time, and the work only starts once the batch is confirmed (with
+-y or -confirm-once); each file is then reported in order, as it would be with a single job:
+
+	ucsrename -copy -o delivery -jobs 4 -y -cat AMBPark -fx Ambience *.wav
+
+With -link, a hardlink is created at each new name instead, so a library can have several named or
+organized views without duplicating its audio. The originals are left in place, and both names refer
+to the same data. Hardlinks can't cross filesystems, which is an error; use -copy there.
+
+Symbolic links are renamed themselves, leaving their targets untouched. With -follow-symlinks, the
+link is resolved and its target is renamed instead; the link is left pointing at the old name.
+
+Some archives require a fixed project code around every name. -prefix and -suffix add text before
+the name and after it (ahead of the extension), so -prefix PROJ- gives PROJ-AMBPark_Fountain_...
+Include any separator in the text itself; underscores aren't allowed. The resulting names don't
+follow the UCS standard. -set and -verify expect the same -prefix and -suffix.
+
+Some filesystems and delivery specs limit the length of filenames. With -max-len, the number of
+characters left for FXName is shown while entering it, and names exceeding the limit are rejected.
+While required fields are still to be entered after FXName, the number shown is an upper bound,
+since only their delimiters are counted.
+Overly long UserData can be shortened automatically with -trim, which truncates it to the number of
+characters given, cutting at a dash where possible so words stay whole, and warns when it does.
+
 CatID, FXName, CreatorID and SourceID are required fields. The UserData field is optional and can be
-used to specify information not captured by the UCS standard.
+used to specify information not captured by the UCS standard. With -tokens, UserData is entered as
+comma-separated tokens that are joined with dashes, so "close, wet, take2" becomes close-wet-take2.
+Spaces within a field are replaced with dashes, or with the character given to -space-char, which
+removes them when it's empty (-space-char=""). An underscore can't be used, since it separates the
+fields.
 
-The program will prompt you for these fields, but some fields can be skipped by setting one of the
+The program will prompt you for these fields, but any of them can be given up front with the -cat,
+-fx, -creator, -source and -user flags. Some fields can also be skipped by setting one of the
 following environment variables:
 
 - UCS_CAT_ID
@@ -89,17 +1177,178 @@ following environment variables:
 - UCS_SOURCE_ID
 - UCS_USER_DATA
 
+Flags apply to every file of a run, so -creator and -source fix those fields for a whole interactive
+session while CatID and FXName are still prompted for each file:
+
+	ucsrename -creator Buddin -source Phonogrifter *.wav
+
+Renamed files stay in their own directories unless -o names another one to move them into; combine
+it with -copy or -link to leave the originals in place. -o puts every file directly in that
+directory. With -keep-structure, each file's folder relative to the working directory is recreated
+under it instead, which mirrors a session tree:
+
+	ucsrename -recursive -o delivery -keep-structure -copy session/
+
 Once a variable is set in the environment, the program will use that value instead of prompting the
-user. This is useful for relatively static fields like CreatorID and SourceID.
+user. This is useful for relatively static fields like CreatorID and SourceID. If a prompt is
+unexpectedly skipped, -show-env reports which variables are set, including any loaded from an
+environment file; add -v to see their values. This help ends with the same summary, limited to the
+variables that are set, along with the category list in use; give -v ahead of -h for the values.
+Flags take precedence over environment variables. For fully automated use, -no-prompt never
+prompts: any required field missing from both the flags and the environment is an error. It must be
+combined with -y.
+
+Defaults can also be given per file type, for mixed batches, by inserting EXT_ and the uppercased
+extension after UCS_: UCS_EXT_WAV_SOURCE_ID=Field and UCS_EXT_FLAC_SOURCE_ID=Library give .wav and
+.flac files different SourceIDs. This works for UCS_CAT_ID, UCS_CREATOR_ID, UCS_SOURCE_ID and
+UCS_USER_DATA. Flags come first, then the plain variable, then the per-extension one, and the field
+is prompted for only when none is set.
+
+Files that arrived without an extension are an error unless UCS_DEFAULT_EXT or -ext gives one to use
+instead (e.g. UCS_DEFAULT_EXT=.wav).
+
+CatIDs are matched regardless of case (ambpark is AMBPark) and always written with the casing used
+by the catalog. If the CatID given isn't valid, the nearest known CatID is offered in its place
+(AMBPark for AMBPrk), and declining it opens fzf with the given CatID as the search so it can be
+corrected. When the program isn't attached to a terminal an invalid CatID is an error instead, which
+suggests the nearest CatIDs.
+
+The variables can also be kept in a file of KEY=VALUE lines, loaded with -env-file. A .ucsrename
+file in the working directory is loaded automatically, which makes it easy to share settings with
+collaborators on a session. Variables set in the environment take precedence over the file. -init
+writes a commented starting point for the file, which can be checked in alongside a session; it
+won't replace an existing file unless -force is given.
+
+Existing UCS filenames can be edited in bulk with -set, which replaces a single field in every UCS
+file within a directory and leaves the other fields intact. Fields are named cat, fx, creator,
+source and user. For example, to change the CreatorID across a library:
 
-fzf is required to provide a helpful, filterable, list of category IDs.
+	ucsrename -set creator=BuddinFX library/
+
+The changes are previewed before anything is renamed. Files that aren't UCS filenames are skipped.
+With -diff, the preview shows the old and new names aligned, with carets under the part that
+changed, making it easy to check that no other field was touched. Once confirmed, the files are
+renamed like any other batch, so -copy, -link, -o, -rename-log and -export-db apply to -set too.
+
+For delivery QA, -verify checks a directory against a manifest CSV. Each row of the manifest gives
+a source file followed by the CatID, FXName, CreatorID, SourceID and, optionally, UserData it should
+be renamed with; a header row starting with Source is skipped. Expected files that are absent are
+reported as missing, other files in the directory are reported as unexpected, and any discrepancy
+is an error:
+
+	ucsrename -verify manifest.csv delivery/
+
+Renames can be recorded with -rename-log, which appends a JSON line to a file for every file
+renamed, giving its original name and fields. -replay applies a log to another directory, matching
+files by their original names, which is useful for redoing a delivery from the raw masters. Files in
+the log that aren't found are reported and skipped. A log written with -required records the fields
+it required, so its names replay without -required being given again:
+
+	ucsrename -rename-log session.log *.wav
+	ucsrename -replay session.log masters/
+
+Names from old media aren't always valid UTF-8. Such a name is warned about before it's renamed,
+since the new name won't carry its original bytes, and with -rename-log they're recorded hex-encoded
+as sourceHex, which -replay matches on.
+
+Delivery metadata can be written alongside with -export-db, which creates a CSV in the layout
+Soundminer and similar DAMs import, with a row for every file renamed. Its columns are FileName,
+Description (the FXName), Category, SubCategory, CatID, CategoryFull, FXName, CreatorID, SourceID,
+UserCategory, UserData and Keywords (the category's synonyms):
+
+	ucsrename -export-db soundminer.csv *.wav
+
+For scripting, -resolve prints the single CatID that best matches a search query and exits. If
+several categories match equally well the candidates are listed in CatID order, so the output is
+the same on every run, and the program exits with an error:
+
+	ucsrename -resolve "guns automatic"
+
+-parse-json prints the fields of an existing file's UCS name as JSON, along with the category its
+CatID refers to, for editor and GUI integrations. The object's valid field is false when the name
+doesn't parse or its CatID is unknown, and issues lists why:
+
+	ucsrename -parse-json AMBPark_Fountain_Buddin_Phonogrifter.wav
+
+-validate-field checks a single value without a file, printing it as it would be entered for the
+field given, or the reason it's rejected with a non-zero exit status. It honors -space-char and
+-required:
+
+	ucsrename -validate-field FXName "Door Slam"
+
+fzf is used to provide a helpful, filterable, list of category IDs. fzf reads the list from
+ucsrename -list-categories, which can also be used directly to browse or grep the categories. Extra
+fzf options can be supplied with the UCS_FZF_OPTS environment variable (e.g.
+UCS_FZF_OPTS="--height=40% --reverse"). Options that only affect presentation, such as --height,
+--layout, --bind, --with-nth and --nth, are safe. Options that change what fzf prints (--multi,
+--print-query, --expect, --print0, --read0 and --filter) are unsupported, because the CatID is read
+from the selected line.
+
+When a CatID is missing from fzf or selects the wrong category, -dump-feed prints the list fzf is
+given and reports on stderr the command it reads the list from, the UCS_FZF_OPTS in effect and any
+line that won't be read back as its own CatID, such as a CatID that's empty or repeated in a custom
+category file, or a category that a newline in one of its fields splits over several lines.
+
+Without fzf, a simpler builtin picker is used: type a search, such as "park ambience", to list the
+ten best matches, then pick one by its number or search again to narrow them down. Alternatively,
+the categories can be numbered with -list-categories -numbered and one selected by its number with
+-cat-index. The numbers follow CatID order, so they stay the same between runs for as long as the
+category list does, and each is the first field of its line, which lets a script list the
+categories, have someone pick one elsewhere and pass the number back:
+
+	ucsrename -list-categories -numbered | grep -i fountain
+	ucsrename -cat-index 42 fountain.wav
+
+-by-name lists the categories by Category and SubCategory instead, collated for the locale in
+LC_ALL, LC_COLLATE or LANG, so that accented names sort alongside their unaccented letters. Each
+keeps its number from the CatID order, so -cat-index still selects it:
+
+	LANG=fr_FR.UTF-8 ucsrename -list-categories -by-name
+
+Teams with their own taxonomy layered on UCS can list it in a CSV file named by
+UCS_USER_CATEGORY_FILE, with a name and an optional description on each row. Once set, a
+UserCategory is selected with fzf after the CatID (press Esc for none) and appended to it with a
+dash, as in AMBPark-Dusk_Fountain_Buddin_Phonogrifter.wav. UCS_USER_CATEGORY provides it up front.
+Some vendors write it in brackets ahead of the CatID instead, as in
+[Dusk]AMBPark_Fountain_Buddin_Phonogrifter.wav, which -bracket-user-category selects. Existing names
+in either notation keep it when they're renamed with -set.
 
 The UCS project has a great video outlining the filename structure:
 https://www.youtube.com/watch?v=0s3ioIbNXSM
 
 A UCS CSV is embedded in the program, but that file can be overridden by setting UCS_CSV_FILE
 environment variable. Once set, all invocations will use that file instead of the embedded UCS CSV
-file.
+file. UCS_CATEGORIES_FILE can be used in its place, and takes precedence. Files ending in .json are
+read as an array of objects with category, subCategory, catID, catShort and synonyms keys instead of
+CSV. Custom CSV files may add a seventh column of colon-separated aliases (e.g. whoosh:blow), which
+are accepted wherever a CatID is given and can be searched for in fzf. The integrity of the embedded
+file can be verified with -selftest. -export writes the loaded categories to a CSV file, which is a
+convenient starting point for a custom file:
+
+	ucsrename -export custom.csv
+
+-compare-builtin reports the CatIDs a custom file adds (+) to the embedded UCS CSV and those it
+drops (-), which is handy for keeping a trimmed subset of UCS in step with new releases:
+
+	ucsrename -compare-builtin custom.csv
+
+For reproducible deliveries, the category list can be pinned by its SHA-256 with UCS_CSV_SHA256 or
+-csv-sha256. The file in use (or the embedded CSV) is then verified before it's read, and the
+program stops if it has changed. -print-sha256 prints the checksum of the current list, which is the
+value to pin:
+
+	export UCS_CSV_SHA256=$(ucsrename -print-sha256)
+
+-add-category adds a category to the custom CSV file without editing it by hand. It prompts for each
+column, refuses a CatID that already exists, and appends a properly quoted row; the embedded CSV is
+read-only, so UCS_CSV_FILE (or UCS_CATEGORIES_FILE, naming a CSV file) must be set first. The new
+category can be selected on the next run.
+
+Exit codes:
+
+	0  success, including -h
+	1  failure; when renaming several files, none were renamed
+	2  partial failure; some files were renamed and others failed
 `
 
 func usageFn(fs *flag.FlagSet) func() {
@@ -109,5 +1358,16 @@ func usageFn(fs *flag.FlagSet) func() {
 		fmt.Fprint(out, "Flags:\n\n")
 		fs.PrintDefaults()
 		fmt.Fprintln(out)
+
+		// The environment is reported as the program would see it, after the env file is loaded.
+		if path := fs.Lookup("env-file").Value.String(); path != "" {
+			if err := loadEnvFile(path, true); err != nil {
+				fmt.Fprintf(out, "Couldn't load %s: %s\n\n", path, err)
+			}
+		} else if err := loadEnvFile(defaultEnvFile, false); err != nil {
+			fmt.Fprintf(out, "Couldn't load %s: %s\n\n", defaultEnvFile, err)
+		}
+		showContext(out, fs.Lookup("v").Value.String() == "true")
+		fmt.Fprintln(out)
 	}
 }
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/brettbuddin/ucsrename/ucs"
+	"github.com/stretchr/testify/require"
+)
+
+// runMain runs the program with args from a fresh working directory, with stdout redirected to a
+// file, so that it isn't a terminal. It returns what was written to stdout.
+func runMain(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	for _, key := range []string{"UCS_CAT_ID", "UCS_CREATOR_ID", "UCS_SOURCE_ID", "UCS_USER_DATA", "UCS_CSV_FILE"} {
+		t.Setenv(key, "")
+	}
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(t.TempDir()))
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	stdout, err := os.Create(filepath.Join(t.TempDir(), "stdout"))
+	require.NoError(t, err)
+	defer stdout.Close()
+	savedArgs, savedStdout := os.Args, os.Stdout
+	os.Args, os.Stdout = append([]string{"ucsrename"}, args...), stdout
+	defer func() { os.Args, os.Stdout = savedArgs, savedStdout }()
+
+	err = run()
+	out, readErr := os.ReadFile(stdout.Name())
+	require.NoError(t, readErr)
+	return string(out), err
+}
+
+func TestRunNonInteractive(t *testing.T) {
+	var feed bytes.Buffer
+	require.NoError(t, ucs.WriteFeed(&feed))
+
+	dir := t.TempDir()
+	src := filepath.Join(dir, "fountain.wav")
+	require.NoError(t, os.WriteFile(src, nil, 0o644))
+
+	// A file argument is renamed, even though stdout isn't a terminal.
+	out, err := runMain(t, "-y", "-no-prompt", "-cat", "AMBPark", "-fx", "Fountain", "-creator", "Buddin", "-source", "Phono", src)
+	require.NoError(t, err)
+	require.FileExists(t, filepath.Join(dir, "AMBPark_Fountain_Buddin_Phono.wav"))
+	require.NotContains(t, out, feed.String())
+
+	out, err = runMain(t, "-list-categories")
+	require.NoError(t, err)
+	require.Equal(t, feed.String(), out)
+}
+
+func TestPrintSHA256(t *testing.T) {
+	t.Setenv("UCS_CSV_FILE", "")
+	_, sum, err := ucs.Checksum()
+	require.NoError(t, err)
+
+	out, err := runMain(t, "-print-sha256")
+	require.NoError(t, err)
+	require.Equal(t, sum+"\n", out)
+}
+
+func TestExpandSubcommand(t *testing.T) {
+	for _, tt := range []struct {
+		args []string
+		want []string
+	}{
+		{nil, nil},
+		{[]string{"-y", "a.wav"}, []string{"-y", "a.wav"}},
+		{[]string{"a.wav", "list"}, []string{"a.wav", "list"}},
+		{[]string{"rename", "-y", "list"}, []string{"-y", "list"}},
+		{[]string{"list", "-numbered"}, []string{"-list-categories", "-numbered"}},
+		{[]string{"check"}, []string{"-selftest"}},
+		{[]string{"diff", "-v", "custom.csv"}, []string{"-v", "-compare-builtin", "custom.csv"}},
+	} {
+		got, err := expandSubcommand(tt.args)
+		require.NoError(t, err, tt.args)
+		require.Equal(t, tt.want, got, tt.args)
+	}
+
+	_, err := expandSubcommand([]string{"diff"})
+	require.ErrorContains(t, err, "diff requires a category file")
+	_, err = expandSubcommand([]string{"diff", "custom.csv", "-v"})
+	require.ErrorContains(t, err, "diff requires a category file")
+}
+
+func TestParseEmbedDate(t *testing.T) {
+	date, err := parseEmbedDate("2024-05-01")
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), date)
+
+	date, err = parseEmbedDate("2024-05-01 10:30:00")
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC), date, "no zone is UTC")
+
+	date, err = parseEmbedDate("2024-05-01T10:30:00-05:00")
+	require.NoError(t, err)
+	require.True(t, date.Equal(time.Date(2024, 5, 1, 15, 30, 0, 0, time.UTC)))
+
+	_, err = parseEmbedDate("yesterday")
+	require.ErrorContains(t, err, "invalid -date value")
+}
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	since, err := parseSince("2h", now)
+	require.NoError(t, err)
+	require.Equal(t, now.Add(-2*time.Hour), since)
+
+	since, err = parseSince("2024-04-01T10:00:00Z", now)
+	require.NoError(t, err)
+	require.True(t, since.Equal(time.Date(2024, 4, 1, 10, 0, 0, 0, time.UTC)))
+
+	since, err = parseSince("2024-04-01", now)
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2024, 4, 1, 0, 0, 0, 0, time.Local), since)
+
+	_, err = parseSince("yesterday", now)
+	require.ErrorContains(t, err, "invalid -since value")
+}
+
+func TestCatIDAt(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, printCategories(&buf, false))
+	first, _, _ := strings.Cut(buf.String(), "\n")
+
+	catID, err := catIDAt(1)
+	require.NoError(t, err)
+	require.Equal(t, "   1  "+catID+":", first[:len(catID)+7])
+
+	// A line's number, read back as a script would, selects the CatID on that line.
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	for i := 0; i < len(lines); i += 100 {
+		fields := strings.Fields(lines[i])
+		n, err := strconv.Atoi(fields[0])
+		require.NoError(t, err)
+		catID, err := catIDAt(n)
+		require.NoError(t, err)
+		require.Equal(t, catID+":", fields[1])
+	}
+
+	_, err = catIDAt(0)
+	require.ErrorContains(t, err, "invalid -cat-index")
+	_, err = catIDAt(100000)
+	require.ErrorContains(t, err, "invalid -cat-index")
+}
+
+func TestPrintCategoriesByName(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "custom.csv")
+	csv := "ZOO,MISC,ZOOMisc,ZOO,,\nÉQUIPEMENT,MISC,AAAEquip,EQP,,\nEAU,VAGUE,EAUVague,EAU,,\n"
+	require.NoError(t, os.WriteFile(path, []byte(csv), 0o644))
+	t.Setenv("UCS_CSV_FILE", path)
+	t.Setenv("LC_ALL", "fr_FR.UTF-8")
+
+	var buf bytes.Buffer
+	require.NoError(t, printCategories(&buf, true))
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		fields := strings.Fields(line)
+		lines = append(lines, fields[0]+" "+fields[1])
+	}
+	// É sorts alongside E rather than after Z, and each line keeps its number in CatID order.
+	require.Equal(t, []string{"2 EAUVague:", "1 AAAEquip:", "3 ZOOMisc:"}, lines)
+}
+
+func TestWalkDirs(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.wav", "notes.txt", "bounce/b.wav", "bounce/renders/c.wav", ".cache/d.wav"} {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, nil, 0o644))
+	}
+	single := filepath.Join(dir, "notes.txt")
+
+	files, err := walkDirs([]string{dir, single}, nil, time.Time{}, -1)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		filepath.Join(dir, "a.wav"),
+		filepath.Join(dir, "bounce", "b.wav"),
+		filepath.Join(dir, "bounce", "renders", "c.wav"),
+		single,
+	}, files)
+
+	files, err = walkDirs([]string{dir}, nil, time.Time{}, 0)
+	require.NoError(t, err)
+	require.Equal(t, []string{filepath.Join(dir, "a.wav")}, files)
+
+	files, err = walkDirs([]string{dir}, nil, time.Time{}, 1)
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+
+	_, err = walkDirs([]string{filepath.Join(dir, ".cache")}, []string{".aif"}, time.Time{}, -1)
+	require.ErrorContains(t, err, "no renamable files in")
+}
+
+func TestPrintParsed(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, printParsed(&buf, "dir/AMBPark_Fountain_Buddin_Phonogrifter.wav", ucs.Affix{}))
+	var p parsed
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &p))
+	require.True(t, p.Valid)
+	require.Empty(t, p.Issues)
+	require.Equal(t, "Fountain", p.Filename.FXName)
+	require.Equal(t, "PARK", p.Filename.Category.SubCategory)
+
+	buf.Reset()
+	require.NoError(t, printParsed(&buf, "AMBPrak_Fountain_Buddin_Phonogrifter.wav", ucs.Affix{}))
+	p = parsed{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &p))
+	require.False(t, p.Valid)
+	require.Equal(t, []string{`unknown CatID "AMBPrak"`}, p.Issues)
+
+	buf.Reset()
+	require.NoError(t, printParsed(&buf, "fountain.wav", ucs.Affix{}))
+	p = parsed{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &p))
+	require.False(t, p.Valid)
+	require.Nil(t, p.Filename)
+	require.Len(t, p.Issues, 1)
+}
+
+func TestExpandGlobs(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"take[1].wav", "a.wav", "b.wav", "notes.txt"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0o644))
+	}
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	for _, tt := range []struct {
+		name    string
+		arg     string
+		want    []string
+		wantErr string
+	}{
+		{"existing literal with metacharacters", path("take[1].wav"), []string{path("take[1].wav")}, ""},
+		{"pattern", path("?.wav"), []string{path("a.wav"), path("b.wav")}, ""},
+		{"pattern skipping unrenamable files", path("*.txt"), nil, "no renamable files match"},
+		{"pattern matching nothing", path("*.flac"), nil, "no renamable files match"},
+		{"malformed pattern", path("[a.wav"), nil, "invalid pattern"},
+		{"plain name", path("missing.wav"), []string{path("missing.wav")}, ""},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			files, err := expandGlobs([]string{tt.arg}, nil, time.Time{})
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, files)
+		})
+	}
+}
+
+func TestSplitFileList(t *testing.T) {
+	names, err := splitFileList("a.wav\x00dir/b c.wav\x00new\nline.wav\x00", true)
+	require.NoError(t, err)
+	require.Equal(t, []string{"a.wav", "dir/b c.wav", "new\nline.wav"}, names)
+
+	names, err = splitFileList("a.wav\r\n\nb.wav\n", false)
+	require.NoError(t, err)
+	require.Equal(t, []string{"a.wav", "b.wav"}, names)
+
+	_, err = splitFileList("\x00", true)
+	require.Error(t, err)
+}
+
+func TestValidateField(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, validateField(&buf, "fx", "  Door   Slam ", "-", nil))
+	require.Equal(t, "Door-Slam\n", buf.String())
+
+	buf.Reset()
+	require.NoError(t, validateField(&buf, "CatID", "ambpark", "-", nil))
+	require.Equal(t, "AMBPark\n", buf.String())
+
+	buf.Reset()
+	require.NoError(t, validateField(&buf, "UserData", "", "-", nil))
+	require.Equal(t, "\n", buf.String())
+
+	require.ErrorIs(t, validateField(&buf, "FXName", "Door_Slam", "-", nil), ucs.ErrDelimiter)
+	require.EqualError(t, validateField(&buf, "SourceID", " ", "-", nil), "SourceID is required")
+	require.EqualError(t, validateField(&buf, "cat", "AMBPrak", "-", nil), `unknown CatID "AMBPrak"`)
+	require.EqualError(t, validateField(&buf, "name", "x", "-", nil), "unknown field: name")
+}
@@ -0,0 +1,14 @@
+//go:build !linux && !darwin && !windows
+
+package renamer
+
+import (
+	"io/fs"
+	"time"
+)
+
+// accessTime returns the last access time of a file. The access time isn't available portably on
+// this platform, so the modification time stands in for it.
+func accessTime(info fs.FileInfo) time.Time {
+	return info.ModTime()
+}
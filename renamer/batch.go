@@ -0,0 +1,416 @@
+package renamer
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/brettbuddin/ucsrename/ucs"
+)
+
+// RunAll renames each of the given files. The fields of every file are gathered first, so that
+// collisions within the batch are reported before anything is renamed. Renaming then stops at the
+// first error unless KeepGoing is set, in which case errors are reported on Stderr and the remaining
+// files are still renamed. A *BatchError is returned if any file fails.
+func (r Renamer) RunAll(filenames []string, forceConfirm bool) error {
+	// A lone file is renamed as Run would, unless it needs numbering within the batch.
+	if len(filenames) == 1 && r.Sequence == 0 && !r.OrderUserData {
+		return r.Run(filenames[0], forceConfirm)
+	}
+	if err := checkCatalog(); err != nil {
+		return err
+	}
+
+	batchErr := &BatchError{Total: len(filenames)}
+	fail := func(filename string, err error) bool {
+		return r.fail(batchErr, filename, err)
+	}
+
+	unifyExt := r.extUnifier(filenames)
+	stems := stemGroups(filenames)
+	shared := map[string]ucs.Filename{}
+	var (
+		ctx  promptContext
+		take int
+	)
+
+	// With Sequence, the fields are prompted once and every file (or stem, when grouping) is numbered.
+	var (
+		sequenced  *ucs.Filename
+		seqNumbers = map[string]int{}
+		seqUnits   = len(filenames)
+	)
+	if r.GroupStems {
+		seqUnits = len(stems)
+	}
+	seqWidth := len(strconv.Itoa(r.Sequence + seqUnits - 1))
+
+	// With OrderUserData, files (or stems) are numbered by their sorted position instead.
+	var (
+		order      = map[string]int{}
+		orderWidth = len(strconv.Itoa(seqUnits))
+	)
+	if r.OrderUserData {
+		sorted := slices.Clone(filenames)
+		slices.Sort(sorted)
+		for _, filename := range sorted {
+			key := filename
+			if stem, _ := splitStem(filename); r.GroupStems && len(stems[stem]) > 1 {
+				key = stem
+			}
+			if _, ok := order[key]; !ok {
+				order[key] = len(order) + 1
+			}
+		}
+	}
+
+	var plan []Rename
+	for _, filename := range filenames {
+		src, ext, err := r.source(filename)
+		if err != nil {
+			if !fail(filename, err) {
+				return batchErr
+			}
+			continue
+		}
+		ext = unifyExt(ext)
+		ctx.ext = ext
+		ctx.embedded = r.embeddedFields(src)
+
+		stem, variant := splitStem(filename)
+		grouped := r.GroupStems && len(stems[stem]) > 1
+		f, ok := shared[stem]
+		if sequenced != nil {
+			f = *sequenced
+		} else if !grouped || !ok {
+			if grouped {
+				fmt.Fprintf(r.Stdout, "\n%s\n", strings.Join(stems[stem], ", "))
+			} else {
+				fmt.Fprintf(r.Stdout, "\n%s\n", filepath.Base(filename))
+			}
+			f, err = r.buildFilename(ctx)
+			if err != nil {
+				if !fail(filename, err) {
+					return batchErr
+				}
+				continue
+			}
+			if r.ReuseFXName {
+				if f.FXName == ctx.reuseFXName {
+					take++
+					f.UserData = appendToken(f.UserData, fmt.Sprintf("take%d", take))
+				} else {
+					take = 1
+				}
+				ctx.reuseFXName = f.FXName
+			}
+			if r.ShareFields {
+				// r is a copy, so the answers only carry over within this batch.
+				r.Preset.CatID = f.CatID
+				r.Preset.UserCategory = f.UserCategory
+				r.Preset.CreatorID = f.CreatorID
+				r.Preset.SourceID = f.SourceID
+			}
+			shared[stem] = f
+			if r.Sequence > 0 {
+				fields := f
+				sequenced = &fields
+			}
+		}
+		if r.Sequence > 0 {
+			key := filename
+			if grouped {
+				key = stem
+			}
+			n, ok := seqNumbers[key]
+			if !ok {
+				n = r.Sequence + len(seqNumbers)
+				seqNumbers[key] = n
+			}
+			f.FXName = appendToken(f.FXName, fmt.Sprintf("%0*d", seqWidth, n))
+		}
+		if r.OrderUserData {
+			key := filename
+			if grouped {
+				key = stem
+			}
+			f.UserData = appendToken(fmt.Sprintf("%0*d", orderWidth, order[key]), f.UserData)
+		}
+		if grouped {
+			f, err = withVariant(f, variant)
+			if err != nil {
+				if !fail(filename, err) {
+					return batchErr
+				}
+				continue
+			}
+		}
+		p, err := r.newRename(src, ext, f)
+		if err != nil {
+			if !fail(filename, err) {
+				return batchErr
+			}
+			continue
+		}
+		plan = append(plan, p)
+	}
+
+	if err := r.checkPlan(plan); err != nil {
+		return err
+	}
+
+	if r.ConfirmOnce && !forceConfirm {
+		if err := r.printPlan(plan); err != nil {
+			return err
+		}
+		ok, err := r.prompter().Confirm(fmt.Sprintf("%s %d files?", r.verb(), len(plan)))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			fmt.Fprintln(r.Stdout, "Nothing was renamed")
+			return nil
+		}
+		forceConfirm = true
+	}
+
+	done, ok := r.applyPlan(plan, forceConfirm, batchErr)
+	if !ok {
+		return batchErr
+	}
+	if err := r.report(done); err != nil {
+		return err
+	}
+	if batchErr.Failed > 0 {
+		return batchErr
+	}
+	return nil
+}
+
+// applyPlan carries out a checked plan through apply, reporting the progress of each file, and
+// returns the Filenames that were renamed. Failures are recorded in batchErr; when one stops the
+// batch, false is returned. It's shared by every mode that renames a set of files, so that they all
+// transfer, log and report files the same way.
+func (r Renamer) applyPlan(plan []Rename, forceConfirm bool, batchErr *BatchError) ([]ucs.Filename, bool) {
+	if r.concurrent(forceConfirm) {
+		done := r.applyConcurrently(plan, batchErr)
+		if batchErr.Err != nil {
+			return done, false
+		}
+		r.reportSkips(len(plan) - batchErr.Renamed - batchErr.Failed)
+		return done, true
+	}
+
+	var done []ucs.Filename
+	for i, p := range plan {
+		renamed, err := r.apply(p, forceConfirm)
+		if err != nil {
+			if !r.fail(batchErr, p.From, err) {
+				return done, false
+			}
+			continue
+		}
+		if renamed {
+			batchErr.Renamed++
+			done = append(done, p.Filename)
+		}
+		r.progress(i+1, len(plan), p, renamed)
+	}
+	r.reportSkips(len(plan) - batchErr.Renamed - batchErr.Failed)
+	return done, true
+}
+
+// fail records in batchErr that filename failed with err. Unless KeepGoing is set, err stops the
+// batch and false is returned; otherwise it's reported on Stderr and the batch carries on.
+func (r Renamer) fail(batchErr *BatchError, filename string, err error) bool {
+	err = fmt.Errorf("%s: %w", filename, err)
+	batchErr.Failed++
+	if !r.KeepGoing {
+		batchErr.Err = err
+		return false
+	}
+	fmt.Fprintln(r.Stderr, err)
+	return true
+}
+
+// printPlan writes each planned rename to Stdout, with any warnings about it, so that a batch can be
+// reviewed before it's confirmed.
+func (r Renamer) printPlan(plan []Rename) error {
+	for _, p := range plan {
+		if r.Diff {
+			for _, line := range diffLines(filepath.Base(p.From), filepath.Base(p.To)) {
+				fmt.Fprintln(r.Stdout, line)
+			}
+		} else {
+			fmt.Fprintf(r.Stdout, "%s -> %s\n", filepath.Base(p.From), filepath.Base(p.To))
+		}
+		warnings, err := r.renameWarnings(p.From, p.To)
+		if err != nil {
+			return err
+		}
+		for _, w := range warnings {
+			fmt.Fprintf(r.Stdout, "  Warning: %s\n", w)
+		}
+	}
+	return nil
+}
+
+// BatchError is returned by RunAll when one or more files fail to rename.
+type BatchError struct {
+	Total   int
+	Renamed int
+	Failed  int
+
+	// Err is the error that stopped the batch. It's nil when KeepGoing is set, because every error
+	// has already been reported.
+	Err error
+}
+
+func (e *BatchError) Error() string {
+	if e.Err != nil {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%d of %d files failed", e.Failed, e.Total)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// progress reports the outcome of a single file within a batch on Stderr, so that it doesn't mix with
+// any output on Stdout. Nothing is reported when Quiet is set; Verbose adds the individual fields.
+func (r Renamer) progress(n, total int, p Rename, renamed bool) {
+	if r.Quiet {
+		return
+	}
+	if !renamed {
+		if !r.QuietSkips {
+			fmt.Fprintf(r.Stderr, "[%d/%d] Skipped %s\n", n, total, p.From)
+		}
+		return
+	}
+	fmt.Fprintf(r.Stderr, "[%d/%d] %s\n", n, total, filepath.Base(p.To))
+	if r.Verbose {
+		f := p.Filename
+		fmt.Fprintf(r.Stderr, "  CatID: %s\n  FXName: %s\n  CreatorID: %s\n  SourceID: %s\n  UserData: %s\n",
+			f.CatID, f.FXName, f.CreatorID, f.SourceID, f.UserData)
+	}
+}
+
+// reportSkips reports the number of files that were skipped, when QuietSkips has suppressed the
+// individual messages.
+func (r Renamer) reportSkips(n int) {
+	if r.QuietSkips && n > 0 {
+		fmt.Fprintf(r.Stderr, "Skipped %d files\n", n)
+	}
+}
+
+// Collision is a set of Filenames within a batch that are identical, and so would render to the same
+// name.
+type Collision struct {
+	Filename ucs.Filename
+
+	// Indexes are the positions of the colliding Filenames in the batch.
+	Indexes []int
+}
+
+// DetectCollisions finds the Filenames in a batch that are identical. Only the name segments are
+// compared; the resolved Category is ignored. Collisions are returned in the order they first occur.
+func DetectCollisions(filenames []ucs.Filename) []Collision {
+	seen := map[ucs.Filename]int{}
+	var collisions []Collision
+	for i, f := range filenames {
+		key := f
+		key.Category = nil
+		j, ok := seen[key]
+		if !ok {
+			seen[key] = len(collisions)
+			collisions = append(collisions, Collision{Filename: f, Indexes: []int{i}})
+			continue
+		}
+		collisions[j].Indexes = append(collisions[j].Indexes, i)
+	}
+
+	var found []Collision
+	for _, c := range collisions {
+		if len(c.Indexes) > 1 {
+			found = append(found, c)
+		}
+	}
+	return found
+}
+
+// planCollisions describes the renames within plan that share a destination. Filenames only collide
+// when they are renamed within the same directory using the same extension.
+func planCollisions(plan []Rename) []string {
+	groups := map[string][]int{}
+	var keys []string
+	for i, p := range plan {
+		key := filepath.Join(filepath.Dir(p.To), filepath.Ext(p.To))
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], i)
+	}
+
+	var descriptions []string
+	for _, key := range keys {
+		indexes := groups[key]
+		filenames := make([]ucs.Filename, len(indexes))
+		for i, j := range indexes {
+			filenames[i] = plan[j].Filename
+		}
+		for _, c := range DetectCollisions(filenames) {
+			var sources []string
+			for _, i := range c.Indexes {
+				sources = append(sources, filepath.Base(plan[indexes[i]].From))
+			}
+			descriptions = append(descriptions, fmt.Sprintf("Collision: %s would all be renamed to %s",
+				strings.Join(sources, ", "), filepath.Base(plan[indexes[c.Indexes[0]]].To)))
+		}
+	}
+	return descriptions
+}
+
+// splitStem splits filename into its stem and variant. The stem is the directory and the portion of
+// the base name preceding the first dot; the variant is whatever remains between the stem and the
+// extension. For example, dir/foo.L.wav has the stem dir/foo and the variant L.
+func splitStem(filename string) (string, string) {
+	base := filepath.Base(filename)
+	base = strings.TrimSuffix(base, filepath.Ext(base))
+	stem, variant, _ := strings.Cut(base, ".")
+	return filepath.Join(filepath.Dir(filename), stem), variant
+}
+
+// stemGroups maps each stem to the base names of the files sharing it, in the order given.
+func stemGroups(filenames []string) map[string][]string {
+	groups := map[string][]string{}
+	for _, filename := range filenames {
+		stem, _ := splitStem(filename)
+		groups[stem] = append(groups[stem], filepath.Base(filename))
+	}
+	return groups
+}
+
+// withVariant appends a stem variant to the UserData of f.
+func withVariant(f ucs.Filename, variant string) (ucs.Filename, error) {
+	token, err := ucs.SanitizeSegment(variant)
+	if err != nil {
+		return f, fmt.Errorf("variant %q: %w", variant, err)
+	}
+	f.UserData = appendToken(f.UserData, token)
+	return f, nil
+}
+
+// appendToken appends a dash-separated token to a field, such as UserData.
+func appendToken(field, token string) string {
+	if token == "" {
+		return field
+	}
+	if field == "" {
+		return token
+	}
+	return field + "-" + token
+}
@@ -0,0 +1,404 @@
+package renamer
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/brettbuddin/ucsrename/ucs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunAllProgress(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.wav")
+	b := filepath.Join(dir, "b.wav")
+	require.NoError(t, os.WriteFile(a, nil, 0o644))
+	require.NoError(t, os.WriteFile(b, nil, 0o644))
+
+	r := testRenamer(t, "Fountain\n\nBirds\n\n")
+	require.NoError(t, r.RunAll([]string{a, b}, true))
+	require.Equal(t,
+		"[1/2] AMBPark_Fountain_Buddin_Phonogrifter.wav\n[2/2] AMBPark_Birds_Buddin_Phonogrifter.wav\n",
+		r.Stderr.(*bytes.Buffer).String(),
+	)
+}
+
+func TestRunLowerExt(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "foo.WAV")
+	require.NoError(t, os.WriteFile(src, nil, 0o644))
+
+	r := testRenamer(t, "Fountain\n\n")
+	r.LowerExt = true
+	require.NoError(t, r.Run(src, true))
+	require.FileExists(t, filepath.Join(dir, "AMBPark_Fountain_Buddin_Phonogrifter.wav"))
+}
+
+func TestRunAllKeepGoing(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.wav")
+	b := filepath.Join(dir, "b.wav")
+	require.NoError(t, os.WriteFile(a, nil, 0o644))
+	require.NoError(t, os.WriteFile(b, nil, 0o644))
+	missing := filepath.Join(dir, "missing.wav")
+
+	r := testRenamer(t, "Fountain\n\nBirds\n\n")
+	r.KeepGoing = true
+	err := r.RunAll([]string{a, missing, b}, true)
+
+	var batchErr *BatchError
+	require.ErrorAs(t, err, &batchErr)
+	require.Equal(t, BatchError{Total: 3, Renamed: 2, Failed: 1}, *batchErr)
+	require.Contains(t, r.Stderr.(*bytes.Buffer).String(), "missing.wav")
+
+	r = testRenamer(t, "")
+	err = r.RunAll([]string{missing, b}, true)
+	require.ErrorAs(t, err, &batchErr)
+	require.Equal(t, 0, batchErr.Renamed, "stops at the first failure")
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestDetectCollisions(t *testing.T) {
+	fountain := ucs.Filename{CatID: "AMBPark", FXName: "Fountain", CreatorID: "Buddin", SourceID: "Phonogrifter"}
+	birds := ucs.Filename{CatID: "AMBPark", FXName: "Birds", CreatorID: "Buddin", SourceID: "Phonogrifter"}
+	closeBirds := birds
+	closeBirds.UserData = "Close"
+
+	collisions := DetectCollisions([]ucs.Filename{fountain, birds, closeBirds, fountain, birds, fountain})
+	require.Equal(t, []Collision{
+		{Filename: fountain, Indexes: []int{0, 3, 5}},
+		{Filename: birds, Indexes: []int{1, 4}},
+	}, collisions)
+
+	require.Empty(t, DetectCollisions([]ucs.Filename{fountain, birds, closeBirds}))
+
+	resolved := fountain
+	resolved.Category = &ucs.Category{CatID: "AMBPark"}
+	other := fountain
+	other.Category = &ucs.Category{CatID: "AMBPark"}
+	collisions = DetectCollisions([]ucs.Filename{resolved, other, fountain})
+	require.Len(t, collisions, 1, "filenames with distinct Category pointers still collide")
+	require.Equal(t, []int{0, 1, 2}, collisions[0].Indexes)
+}
+
+func TestRunAllCollisions(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.wav")
+	b := filepath.Join(dir, "b.wav")
+	c := filepath.Join(dir, "c.flac")
+	for _, name := range []string{a, b, c} {
+		require.NoError(t, os.WriteFile(name, nil, 0o644))
+	}
+
+	r := testRenamer(t, "Fountain\n\nFountain\n\nFountain\n\n")
+	require.ErrorContains(t, r.RunAll([]string{a, b, c}, true), "nothing was renamed")
+	require.Contains(t, r.Stderr.(*bytes.Buffer).String(), "a.wav, b.wav would all be renamed to AMBPark_Fountain_Buddin_Phonogrifter.wav")
+	require.NotContains(t, r.Stderr.(*bytes.Buffer).String(), "c.flac", "different extensions don't collide")
+	require.FileExists(t, a)
+	require.FileExists(t, b)
+}
+
+func TestRunAllGroupStems(t *testing.T) {
+	dir := t.TempDir()
+	var filenames []string
+	for _, name := range []string{"foo.wav", "foo.L.wav", "foo.R.wav", "bar.wav"} {
+		filenames = append(filenames, filepath.Join(dir, name))
+		require.NoError(t, os.WriteFile(filenames[len(filenames)-1], nil, 0o644))
+	}
+
+	r := testRenamer(t, "Fountain\nStereo\nBirds\n\n")
+	r.GroupStems = true
+	require.NoError(t, r.RunAll(filenames, true))
+
+	for _, name := range []string{
+		"AMBPark_Fountain_Buddin_Phonogrifter_Stereo.wav",
+		"AMBPark_Fountain_Buddin_Phonogrifter_Stereo-L.wav",
+		"AMBPark_Fountain_Buddin_Phonogrifter_Stereo-R.wav",
+		"AMBPark_Birds_Buddin_Phonogrifter.wav",
+	} {
+		require.FileExists(t, filepath.Join(dir, name))
+	}
+}
+
+func TestRunAllReuseFXName(t *testing.T) {
+	dir := t.TempDir()
+	var filenames []string
+	for _, name := range []string{"a.wav", "b.wav", "c.wav", "d.wav"} {
+		filenames = append(filenames, filepath.Join(dir, name))
+		require.NoError(t, os.WriteFile(filenames[len(filenames)-1], nil, 0o644))
+	}
+
+	r := testRenamer(t, "Door Slam\n\n\n\n\nClose\nBirds\n\n")
+	r.ReuseFXName = true
+	require.NoError(t, r.RunAll(filenames, true))
+
+	for _, name := range []string{
+		"AMBPark_Door-Slam_Buddin_Phonogrifter.wav",
+		"AMBPark_Door-Slam_Buddin_Phonogrifter_take2.wav",
+		"AMBPark_Door-Slam_Buddin_Phonogrifter_Close-take3.wav",
+		"AMBPark_Birds_Buddin_Phonogrifter.wav",
+	} {
+		require.FileExists(t, filepath.Join(dir, name))
+	}
+}
+
+func TestRunAllSequence(t *testing.T) {
+	dir := t.TempDir()
+	var filenames []string
+	for i := 0; i < 10; i++ {
+		filenames = append(filenames, filepath.Join(dir, fmt.Sprintf("slam%d.wav", i)))
+		require.NoError(t, os.WriteFile(filenames[i], nil, 0o644))
+	}
+
+	r := testRenamer(t, "Door Slam\n\n")
+	r.Sequence = 1
+	require.NoError(t, r.RunAll(filenames, true))
+
+	require.FileExists(t, filepath.Join(dir, "AMBPark_Door-Slam-01_Buddin_Phonogrifter.wav"))
+	require.FileExists(t, filepath.Join(dir, "AMBPark_Door-Slam-10_Buddin_Phonogrifter.wav"))
+	require.Equal(t, 1, strings.Count(r.Stdout.(*bytes.Buffer).String(), "FXName:"), "fields are prompted once")
+}
+
+func TestRunAllSequenceOneFile(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "slam.wav")
+	require.NoError(t, os.WriteFile(filename, nil, 0o644))
+
+	r := testRenamer(t, "Door Slam\n\n")
+	r.Sequence = 3
+	require.NoError(t, r.RunAll([]string{filename}, true))
+
+	require.FileExists(t, filepath.Join(dir, "AMBPark_Door-Slam-3_Buddin_Phonogrifter.wav"))
+}
+
+func TestRunAllOrderUserData(t *testing.T) {
+	dir := t.TempDir()
+	var filenames []string
+	for _, name := range []string{"c.wav", "a.wav", "b.wav"} {
+		filenames = append(filenames, filepath.Join(dir, name))
+		require.NoError(t, os.WriteFile(filenames[len(filenames)-1], nil, 0o644))
+	}
+
+	// Prompted in the order given; numbered in sorted order.
+	r := testRenamer(t, "Rain\n\nBirds\nclose\nWind\n\n")
+	r.OrderUserData = true
+	require.NoError(t, r.RunAll(filenames, true))
+
+	require.FileExists(t, filepath.Join(dir, "AMBPark_Rain_Buddin_Phonogrifter_3.wav"))
+	require.FileExists(t, filepath.Join(dir, "AMBPark_Birds_Buddin_Phonogrifter_1-close.wav"))
+	require.FileExists(t, filepath.Join(dir, "AMBPark_Wind_Buddin_Phonogrifter_2.wav"))
+}
+
+func TestRunAllOrderUserDataOneFile(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "rain.wav")
+	require.NoError(t, os.WriteFile(filename, nil, 0o644))
+
+	r := testRenamer(t, "Rain\nclose\n")
+	r.OrderUserData = true
+	require.NoError(t, r.RunAll([]string{filename}, true))
+
+	require.FileExists(t, filepath.Join(dir, "AMBPark_Rain_Buddin_Phonogrifter_1-close.wav"))
+}
+
+func TestRunAllShareFields(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.wav")
+	b := filepath.Join(dir, "b.wav")
+	require.NoError(t, os.WriteFile(a, nil, 0o644))
+	require.NoError(t, os.WriteFile(b, nil, 0o644))
+
+	r := testRenamer(t, "Fountain\nStudio\nSession\n\nBirds\n\n")
+	t.Setenv("UCS_CREATOR_ID", "")
+	t.Setenv("UCS_SOURCE_ID", "")
+	r.ShareFields = true
+	require.NoError(t, r.RunAll([]string{a, b}, true))
+
+	require.FileExists(t, filepath.Join(dir, "AMBPark_Fountain_Studio_Session.wav"))
+	require.FileExists(t, filepath.Join(dir, "AMBPark_Birds_Studio_Session.wav"))
+}
+
+func TestRunAllSessionPreset(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.wav")
+	b := filepath.Join(dir, "b.wav")
+	require.NoError(t, os.WriteFile(a, nil, 0o644))
+	require.NoError(t, os.WriteFile(b, nil, 0o644))
+
+	// Only FXName and UserData are prompted for, once per file.
+	r := testRenamer(t, "Fountain\n\nBirds\nfar\n")
+	t.Setenv("UCS_CREATOR_ID", "")
+	t.Setenv("UCS_SOURCE_ID", "")
+	r.Preset.CreatorID = "Studio"
+	r.Preset.SourceID = "Session"
+	require.NoError(t, r.RunAll([]string{a, b}, true))
+
+	require.FileExists(t, filepath.Join(dir, "AMBPark_Fountain_Studio_Session.wav"))
+	require.FileExists(t, filepath.Join(dir, "AMBPark_Birds_Studio_Session_far.wav"))
+}
+
+func TestRunAllUnifyExt(t *testing.T) {
+	for _, tt := range []struct {
+		lowerExt bool
+		want     string
+	}{
+		{false, ".WAV"},
+		{true, ".wav"},
+	} {
+		dir := t.TempDir()
+		var files []string
+		for _, name := range []string{"a.wav", "b.WAV", "c.WAV"} {
+			files = append(files, filepath.Join(dir, name))
+			require.NoError(t, os.WriteFile(files[len(files)-1], nil, 0o644))
+		}
+
+		r := testRenamer(t, "Alpha\n\nBravo\n\nCharlie\n\n")
+		r.UnifyExt = true
+		r.LowerExt = tt.lowerExt
+		require.NoError(t, r.RunAll(files, true))
+		for _, fx := range []string{"Alpha", "Bravo", "Charlie"} {
+			name := "AMBPark_" + fx + "_Buddin_Phonogrifter" + tt.want
+			entries, err := os.ReadDir(dir)
+			require.NoError(t, err)
+			require.True(t, slices.ContainsFunc(entries, func(e os.DirEntry) bool { return e.Name() == name }), name)
+		}
+		require.Contains(t, r.Stderr.(*bytes.Buffer).String(), "Warning: the extensions differ in case (.WAV, .wav)")
+	}
+}
+
+func TestRunAllConfirmOnce(t *testing.T) {
+	for _, confirm := range []bool{false, true} {
+		dir := t.TempDir()
+		a := filepath.Join(dir, "a.wav")
+		b := filepath.Join(dir, "b.wav")
+		require.NoError(t, os.WriteFile(a, nil, 0o644))
+		require.NoError(t, os.WriteFile(b, nil, 0o644))
+
+		r := testRenamer(t, "")
+		r.ConfirmOnce = true
+		r.Prompter = &ScriptedPrompter{
+			Inputs:   []string{"Alpha", "", "Bravo", ""},
+			Confirms: []bool{confirm},
+		}
+		require.NoError(t, r.RunAll([]string{a, b}, false))
+
+		out := r.Stdout.(*bytes.Buffer).String()
+		require.Contains(t, out, "a.wav -> AMBPark_Alpha_Buddin_Phonogrifter.wav\nb.wav -> AMBPark_Bravo_Buddin_Phonogrifter.wav\n")
+		if confirm {
+			require.FileExists(t, filepath.Join(dir, "AMBPark_Alpha_Buddin_Phonogrifter.wav"))
+			require.FileExists(t, filepath.Join(dir, "AMBPark_Bravo_Buddin_Phonogrifter.wav"))
+		} else {
+			require.Contains(t, out, "Nothing was renamed")
+			require.FileExists(t, a)
+			require.FileExists(t, b)
+		}
+	}
+}
+
+func TestRunAllJobs(t *testing.T) {
+	dir := t.TempDir()
+	var (
+		filenames []string
+		stdin     strings.Builder
+		progress  strings.Builder
+	)
+	for i := 1; i <= 8; i++ {
+		path := filepath.Join(dir, fmt.Sprintf("take%d.wav", i))
+		require.NoError(t, os.WriteFile(path, []byte(path), 0o644))
+		filenames = append(filenames, path)
+		fmt.Fprintf(&stdin, "Take%d\n\n", i)
+		fmt.Fprintf(&progress, "[%d/8] AMBPark_Take%d_Buddin_Phonogrifter.wav\n", i, i)
+	}
+
+	out := t.TempDir()
+	var log bytes.Buffer
+	r := testRenamer(t, stdin.String())
+	r.Copy = true
+	r.OutputDir = out
+	r.Jobs = 4
+	r.Log = &log
+	require.NoError(t, r.RunAll(filenames, true))
+	require.Equal(t, progress.String(), r.Stderr.(*bytes.Buffer).String(), "reported in order")
+
+	entries, err := ReadLog(&log)
+	require.NoError(t, err)
+	require.Len(t, entries, 8)
+	for i, e := range entries {
+		require.Equal(t, fmt.Sprintf("take%d.wav", i+1), e.Source)
+		b, err := os.ReadFile(filepath.Join(out, e.Renamed))
+		require.NoError(t, err)
+		require.Equal(t, filenames[i], string(b))
+	}
+
+	// A failure stops the batch, but what was already copied is still logged. The file under sub
+	// can't be copied, because sub is a file in the output directory.
+	sub := filepath.Join(dir, "sub", "take9.wav")
+	require.NoError(t, os.MkdirAll(filepath.Dir(sub), 0o755))
+	require.NoError(t, os.WriteFile(sub, nil, 0o644))
+	out = t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(out, "sub"), nil, 0o644))
+	log.Reset()
+	r = testRenamer(t, "Take1\n\nTake9\n\nTake2\n\n")
+	r.Copy = true
+	r.OutputDir = out
+	r.KeepStructure = true
+	r.StructureRoot = dir
+	r.Jobs = 2
+	r.Log = &log
+	err = r.RunAll([]string{filenames[0], sub, filenames[1]}, true)
+	var batchErr *BatchError
+	require.ErrorAs(t, err, &batchErr)
+	require.ErrorContains(t, err, "take9.wav")
+	require.Equal(t, 1, batchErr.Failed)
+	entries, err = ReadLog(&log)
+	require.NoError(t, err)
+	require.Len(t, entries, batchErr.Renamed)
+	require.Equal(t, "take1.wav", entries[0].Source)
+}
+
+func TestRunAllOutputDir(t *testing.T) {
+	root := t.TempDir()
+	a := filepath.Join(root, "day1", "a.wav")
+	b := filepath.Join(root, "day2", "mics", "b.wav")
+	for _, path := range []string{a, b} {
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, nil, 0o644))
+	}
+
+	t.Run("flat", func(t *testing.T) {
+		out := t.TempDir()
+		r := testRenamer(t, "Fountain\n\nBirds\n\n")
+		r.OutputDir = out
+		r.Copy = true
+		require.NoError(t, r.RunAll([]string{a, b}, true))
+		require.FileExists(t, filepath.Join(out, "AMBPark_Fountain_Buddin_Phonogrifter.wav"))
+		require.FileExists(t, filepath.Join(out, "AMBPark_Birds_Buddin_Phonogrifter.wav"))
+	})
+
+	t.Run("keep structure", func(t *testing.T) {
+		out := t.TempDir()
+		r := testRenamer(t, "Fountain\n\nBirds\n\n")
+		r.OutputDir = out
+		r.KeepStructure = true
+		r.StructureRoot = root
+		require.NoError(t, r.RunAll([]string{a, b}, true))
+		require.FileExists(t, filepath.Join(out, "day1", "AMBPark_Fountain_Buddin_Phonogrifter.wav"))
+		require.FileExists(t, filepath.Join(out, "day2", "mics", "AMBPark_Birds_Buddin_Phonogrifter.wav"))
+		require.NoFileExists(t, a)
+	})
+
+	t.Run("outside the root", func(t *testing.T) {
+		r := testRenamer(t, "Fountain\n\n")
+		r.OutputDir = t.TempDir()
+		r.KeepStructure = true
+		r.StructureRoot = filepath.Join(root, "day1")
+		src := filepath.Join(root, "day2", "mics", "c.wav")
+		require.NoError(t, os.WriteFile(src, nil, 0o644))
+		require.ErrorContains(t, r.Run(src, true), "folder structure can't be kept")
+	})
+}
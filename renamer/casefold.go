@@ -0,0 +1,58 @@
+package renamer
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sameFileCaseOnly reports whether src and dst differ only in case and refer to the same file, which
+// is the case on case-insensitive filesystems such as the defaults on macOS and Windows.
+func (r Renamer) sameFileCaseOnly(src, dst string) (bool, error) {
+	if src == dst || !strings.EqualFold(src, dst) {
+		return false, nil
+	}
+	dstInfo, err := r.filesystem().Lstat(dst)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	srcInfo, err := r.filesystem().Lstat(src)
+	if err != nil {
+		return false, err
+	}
+	return os.SameFile(srcInfo, dstInfo), nil
+}
+
+// renameFile renames src to dst. A rename that only changes case on a case-insensitive filesystem
+// can be silently ignored or refused, so it's done in two steps by way of a temporary name.
+func (r Renamer) renameFile(src, dst string) error {
+	caseOnly, err := r.sameFileCaseOnly(src, dst)
+	if err != nil {
+		return err
+	}
+	if !caseOnly {
+		return r.filesystem().Rename(src, dst)
+	}
+
+	tmp := filepath.Join(filepath.Dir(src), ".ucsrename-"+filepath.Base(src))
+	if _, err := r.filesystem().Lstat(tmp); err == nil {
+		return fmt.Errorf("temporary file %s already exists", tmp)
+	}
+	if err := r.filesystem().Rename(src, tmp); err != nil {
+		return err
+	}
+	if err := r.filesystem().Rename(tmp, dst); err != nil {
+		// Put the file back where it was found.
+		if restoreErr := r.filesystem().Rename(tmp, src); restoreErr != nil {
+			return fmt.Errorf("%w (the file was left at %s)", err, tmp)
+		}
+		return err
+	}
+	return nil
+}
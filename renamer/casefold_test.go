@@ -0,0 +1,65 @@
+package renamer
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// foldingFS simulates a case-insensitive filesystem on top of the host filesystem by resolving names
+// to existing entries that match regardless of case. Renames are recorded.
+type foldingFS struct {
+	osFS
+	renames [][2]string
+}
+
+func (fs *foldingFS) resolve(name string) string {
+	entries, err := os.ReadDir(filepath.Dir(name))
+	if err != nil {
+		return name
+	}
+	for _, e := range entries {
+		if strings.EqualFold(e.Name(), filepath.Base(name)) {
+			return filepath.Join(filepath.Dir(name), e.Name())
+		}
+	}
+	return name
+}
+
+func (fs *foldingFS) Lstat(name string) (fs.FileInfo, error) {
+	return os.Lstat(fs.resolve(name))
+}
+
+func (fs *foldingFS) Rename(oldpath, newpath string) error {
+	fs.renames = append(fs.renames, [2]string{oldpath, newpath})
+	if strings.EqualFold(oldpath, newpath) {
+		// Like some case-insensitive filesystems, quietly ignore a case-only rename.
+		return nil
+	}
+	return os.Rename(fs.resolve(oldpath), newpath)
+}
+
+func TestRenameCaseOnly(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "AMBPARK_Fountain_Buddin_Phonogrifter.wav")
+	dst := filepath.Join(dir, "AMBPark_Fountain_Buddin_Phonogrifter.wav")
+	require.NoError(t, os.WriteFile(src, nil, 0o644))
+
+	folding := &foldingFS{}
+	r := Renamer{FS: folding}
+	require.NoError(t, r.transfer(src, dst))
+	require.Len(t, folding.renames, 2, "renamed by way of a temporary name")
+	require.Equal(t, dst, folding.renames[1][1])
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, filepath.Base(dst), entries[0].Name())
+
+	r.Copy = true
+	require.ErrorContains(t, r.transfer(dst, src), "same file")
+}
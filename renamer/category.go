@@ -0,0 +1,82 @@
+package renamer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/brettbuddin/ucsrename/ucs"
+)
+
+// AddCategory asks for the columns of a new category and appends it to the custom category file
+// named by UCS_CATEGORIES_FILE or UCS_CSV_FILE, so a missing category can be added without editing
+// the CSV by hand. CatShort defaults to that of an existing category with the same Category. The new
+// category can be selected straight away.
+func (r Renamer) AddCategory() error {
+	if _, err := ucs.WritableCategoryFile(); err != nil {
+		return err
+	}
+	categories, err := ucs.Categories()
+	if err != nil {
+		return err
+	}
+
+	var c ucs.Category
+	if c.Category, err = r.inputField("Category", ""); err != nil {
+		return err
+	}
+	if c.SubCategory, err = r.inputField("SubCategory", ""); err != nil {
+		return err
+	}
+	if c.CatID, err = r.inputField("CatID", ""); err != nil {
+		return err
+	}
+	if !ucs.ValidCatIDFormat(c.CatID) {
+		return fmt.Errorf("%q doesn't look like a CatID (e.g. AMBPark)", c.CatID)
+	}
+	if catID, ok := ucs.NewIndex(categories).Canonical(c.CatID); ok {
+		return fmt.Errorf("CatID %s already exists", catID)
+	}
+
+	var catShort string
+	for _, existing := range categories {
+		if strings.EqualFold(existing.Category, c.Category) && existing.CatShort != "" {
+			catShort = existing.CatShort
+			break
+		}
+	}
+	if c.CatShort, err = r.inputField("CatShort", catShort); err != nil {
+		return err
+	}
+	if c.CatShort != "" && !strings.HasPrefix(c.CatID, c.CatShort) {
+		return fmt.Errorf("CatID %s doesn't start with its CatShort %s", c.CatID, c.CatShort)
+	}
+	if c.Explanations, err = r.inputField("Explanations", ""); err != nil {
+		return err
+	}
+	if c.Synonyms, err = r.inputField("Synonyms (comma-separated)", ""); err != nil {
+		return err
+	}
+
+	path, err := ucs.AppendCategory(c)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(r.Stdout, "Added %s to %s\n", c.CatID, path)
+	return nil
+}
+
+// inputField asks for a line of text, trimming surrounding whitespace. An empty answer is def, which
+// is shown in the label when set.
+func (r Renamer) inputField(label, def string) (string, error) {
+	if def != "" {
+		label = fmt.Sprintf("%s [%s]", label, def)
+	}
+	answer, err := r.prompter().Input(label)
+	if err != nil {
+		return "", err
+	}
+	if answer = strings.TrimSpace(answer); answer == "" {
+		return def, nil
+	}
+	return answer, nil
+}
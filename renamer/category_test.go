@@ -0,0 +1,41 @@
+package renamer
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/brettbuddin/ucsrename/ucs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddCategory(t *testing.T) {
+	t.Setenv("UCS_CATEGORIES_FILE", "")
+	t.Setenv("UCS_CSV_FILE", "")
+	r := Renamer{Stdout: &bytes.Buffer{}, Prompter: &ScriptedPrompter{}}
+	require.ErrorContains(t, r.AddCategory(), "embedded UCS CSV is read-only")
+
+	path := filepath.Join(t.TempDir(), "custom.csv")
+	require.NoError(t, os.WriteFile(path, []byte("AIR,BLOW,AIRBlow,AIR,Air blowing,blow"), 0o644))
+	t.Setenv("UCS_CSV_FILE", path)
+
+	r.Prompter = &ScriptedPrompter{Inputs: []string{"AIR", "HISS", "airblow"}}
+	require.EqualError(t, r.AddCategory(), `"airblow" doesn't look like a CatID (e.g. AMBPark)`)
+	r.Prompter = &ScriptedPrompter{Inputs: []string{"AIR", "BLOW", "AIRBLOW"}}
+	require.EqualError(t, r.AddCategory(), "CatID AIRBlow already exists")
+
+	// CatShort defaults to that of the existing AIR category.
+	r.Prompter = &ScriptedPrompter{Inputs: []string{"AIR", "HISS", "AIRHiss", "", "Air hissing, \"sharp\"", "hiss, leak"}}
+	require.NoError(t, r.AddCategory())
+	require.Equal(t, "Added AIRHiss to "+path+"\n", r.Stdout.(*bytes.Buffer).String())
+
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "AIR,BLOW,AIRBlow,AIR,Air blowing,blow\n"+
+		"AIR,HISS,AIRHiss,AIR,\"Air hissing, \"\"sharp\"\"\",\"hiss, leak\"\n", string(b))
+
+	c, err := ucs.Lookup("AIRHiss")
+	require.NoError(t, err)
+	require.Equal(t, "Air hissing, \"sharp\"", c.Explanations)
+}
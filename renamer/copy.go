@@ -0,0 +1,147 @@
+package renamer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// transfer moves src to dst, or copies or hardlinks it when Copy or Link is set. The directory of dst
+// is created when it's under OutputDir. With Embed, the origination date is written into dst once it's
+// in place. With Touch, the modification time of dst is set to the current time afterwards.
+func (r Renamer) transfer(src, dst string) error {
+	if r.OutputDir != "" {
+		if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+			return err
+		}
+	}
+	var err error
+	switch {
+	case r.Copy:
+		err = r.copyFile(src, dst)
+	case r.Link:
+		err = r.linkFile(src, dst)
+	default:
+		err = r.renameFile(src, dst)
+	}
+	if err != nil {
+		return err
+	}
+	// The file is already in place, so failing to embed the date doesn't fail the rename.
+	if err := r.embedOrigination(dst); err != nil {
+		fmt.Fprintf(r.Stderr, "Warning: %s\n", err)
+	}
+	if r.Touch {
+		now := r.now()
+		return os.Chtimes(dst, now, now)
+	}
+	return nil
+}
+
+// TempSuffix is appended to the name of a copy while it's being written. The copy is only renamed to
+// its final name once it's complete and synced to disk, so an interrupted copy never leaves a partial
+// file under the final name.
+const TempSuffix = ".ucsrename.tmp"
+
+// copyFile copies the contents and permissions of src to dst, replacing dst if it exists. Copying
+// resets the timestamps of dst, so the access and modification times of src are replayed onto it.
+// The copy is written next to dst under a temporary name first, and renamed into place when it's
+// complete.
+func (r Renamer) copyFile(src, dst string) error {
+	// On a case-insensitive filesystem, opening dst would truncate src.
+	caseOnly, err := r.sameFileCaseOnly(src, dst)
+	if err != nil {
+		return err
+	}
+	if caseOnly {
+		return fmt.Errorf("can't copy %s to %s, because they're the same file", filepath.Base(src), filepath.Base(dst))
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	tmp := dst + TempSuffix
+	if err := writeCopy(in, tmp, info); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// linkFile creates a hardlink to src at dst. Hardlinks can't cross filesystems, and not every
+// filesystem supports them; both are reported as such, since copying is the way out.
+func (r Renamer) linkFile(src, dst string) error {
+	caseOnly, err := r.sameFileCaseOnly(src, dst)
+	if err != nil {
+		return err
+	}
+	if caseOnly {
+		return fmt.Errorf("can't link %s to %s, because they're the same file", filepath.Base(src), filepath.Base(dst))
+	}
+
+	err = os.Link(src, dst)
+	switch {
+	case errors.Is(err, syscall.EXDEV):
+		return fmt.Errorf("can't link %s to %s, because they're on different filesystems; use -copy instead", src, dst)
+	case errors.Is(err, errors.ErrUnsupported):
+		return fmt.Errorf("can't link %s to %s, because the filesystem doesn't support hardlinks; use -copy instead", src, dst)
+	}
+	return err
+}
+
+// writeCopy writes the contents of in to path, syncs it and replays the timestamps of info onto it.
+func writeCopy(in io.Reader, path string, info os.FileInfo) error {
+	out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(path, accessTime(info), info.ModTime())
+}
+
+// CleanupTemp removes the partial copies left in dir by copies that were interrupted, returning the
+// paths removed. Only files carrying TempSuffix are removed; their originals are untouched by an
+// interrupted copy.
+func CleanupTemp(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var removed []string
+	for _, e := range entries {
+		if !e.Type().IsRegular() || !strings.HasSuffix(e.Name(), TempSuffix) {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		if err := os.Remove(path); err != nil {
+			return removed, err
+		}
+		removed = append(removed, path)
+	}
+	return removed, nil
+}
@@ -0,0 +1,86 @@
+package renamer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunCopy(t *testing.T) {
+	recorded := time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+	setup := func(t *testing.T) (string, string) {
+		dir := t.TempDir()
+		src := filepath.Join(dir, "foo.wav")
+		require.NoError(t, os.WriteFile(src, []byte("RIFF"), 0o644))
+		require.NoError(t, os.Chtimes(src, recorded, recorded))
+		return src, filepath.Join(dir, "AMBPark_Fountain_Buddin_Phonogrifter.wav")
+	}
+
+	t.Run("preserves timestamps", func(t *testing.T) {
+		src, dst := setup(t)
+		r := testRenamer(t, "Fountain\n\n")
+		r.Copy = true
+		require.NoError(t, r.Run(src, true))
+
+		require.FileExists(t, src, "the original is left in place")
+		b, err := os.ReadFile(dst)
+		require.NoError(t, err)
+		require.Equal(t, "RIFF", string(b))
+		info, err := os.Stat(dst)
+		require.NoError(t, err)
+		require.True(t, info.ModTime().Equal(recorded), "got %v", info.ModTime())
+		require.NoFileExists(t, dst+TempSuffix, "the temporary copy was renamed into place")
+	})
+
+	t.Run("touch", func(t *testing.T) {
+		src, dst := setup(t)
+		now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+		r := testRenamer(t, "Fountain\n\n")
+		r.Copy = true
+		r.Touch = true
+		r.Clock = func() time.Time { return now }
+		require.NoError(t, r.Run(src, true))
+
+		info, err := os.Stat(dst)
+		require.NoError(t, err)
+		require.True(t, info.ModTime().Equal(now), "got %v", info.ModTime())
+	})
+}
+
+func TestRunLink(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "foo.wav")
+	dst := filepath.Join(dir, "AMBPark_Fountain_Buddin_Phonogrifter.wav")
+	require.NoError(t, os.WriteFile(src, []byte("RIFF"), 0o644))
+
+	r := testRenamer(t, "Fountain\n\n")
+	r.Link = true
+	require.NoError(t, r.Run(src, true))
+
+	srcInfo, err := os.Stat(src)
+	require.NoError(t, err, "the original is left in place")
+	dstInfo, err := os.Stat(dst)
+	require.NoError(t, err)
+	require.True(t, os.SameFile(srcInfo, dstInfo), "the new name is a hardlink")
+}
+
+func TestCleanupTemp(t *testing.T) {
+	dir := t.TempDir()
+	partial := filepath.Join(dir, "AMBPark_Fountain_Buddin_Phonogrifter.wav"+TempSuffix)
+	require.NoError(t, os.WriteFile(partial, []byte("RI"), 0o644))
+	keep := []string{filepath.Join(dir, "foo.wav"), filepath.Join(dir, "notes.tmp")}
+	for _, path := range keep {
+		require.NoError(t, os.WriteFile(path, nil, 0o644))
+	}
+
+	removed, err := CleanupTemp(dir)
+	require.NoError(t, err)
+	require.Equal(t, []string{partial}, removed)
+	require.NoFileExists(t, partial)
+	for _, path := range keep {
+		require.FileExists(t, path)
+	}
+}
@@ -0,0 +1,72 @@
+package renamer
+
+import (
+	"encoding/csv"
+	"io"
+	"path/filepath"
+
+	"github.com/brettbuddin/ucsrename/ucs"
+)
+
+// databaseColumns are the columns of the metadata CSV written for a DAM such as Soundminer, in order.
+var databaseColumns = []string{
+	"FileName",
+	"Description",
+	"Category",
+	"SubCategory",
+	"CatID",
+	"CategoryFull",
+	"FXName",
+	"CreatorID",
+	"SourceID",
+	"UserCategory",
+	"UserData",
+	"Keywords",
+}
+
+// WriteDatabaseHeader writes the header row of the metadata CSV that Database receives.
+func WriteDatabaseHeader(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(databaseColumns); err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// recordDatabase appends a row for p to Database, if it's set. The category columns are filled in
+// from the catalog; they're left empty if the CatID isn't found.
+func (r Renamer) recordDatabase(p Rename) error {
+	if r.Database == nil {
+		return nil
+	}
+	f := p.Filename
+	var c ucs.Category
+	if index, err := ucs.LoadIndex(); err == nil {
+		c, _ = index.Lookup(f.CatID)
+	}
+	var full string
+	if c.CatID != "" {
+		full = c.Category + "-" + c.SubCategory
+	}
+	cw := csv.NewWriter(r.Database)
+	err := cw.Write([]string{
+		filepath.Base(p.To),
+		f.FXName,
+		c.Category,
+		c.SubCategory,
+		f.CatID,
+		full,
+		f.FXName,
+		f.CreatorID,
+		f.SourceID,
+		f.UserCategory,
+		f.UserData,
+		c.Synonyms,
+	})
+	if err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
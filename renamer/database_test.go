@@ -0,0 +1,39 @@
+package renamer
+
+import (
+	"bytes"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunDatabase(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "fountain.wav")
+	require.NoError(t, os.WriteFile(path, nil, 0o644))
+
+	var db bytes.Buffer
+	require.NoError(t, WriteDatabaseHeader(&db))
+	r := testRenamer(t, "Fountain\nclose\n")
+	r.Database = &db
+	require.NoError(t, r.Run(path, true))
+
+	rows, err := csv.NewReader(&db).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+	require.Equal(t, databaseColumns, rows[0])
+	row := map[string]string{}
+	for i, col := range rows[0] {
+		row[col] = rows[1][i]
+	}
+	require.Equal(t, "AMBPark_Fountain_Buddin_Phonogrifter_close.wav", row["FileName"])
+	require.Equal(t, "Fountain", row["Description"])
+	require.Equal(t, "AMBIENCE", row["Category"])
+	require.Equal(t, "PARK", row["SubCategory"])
+	require.Equal(t, "AMBIENCE-PARK", row["CategoryFull"])
+	require.Equal(t, "close", row["UserData"])
+	require.NotEmpty(t, row["Keywords"])
+}
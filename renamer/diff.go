@@ -0,0 +1,40 @@
+package renamer
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// diffLines describes the change from oldName to newName as aligned lines: the old name prefixed with
+// "- " and the new name prefixed with "+ ", each followed by a line of carets under the portion that
+// differs. The differing portion is what remains after removing the longest common prefix and
+// suffix. A caret line is omitted for a name with nothing removed from or added to it.
+func diffLines(oldName, newName string) []string {
+	oldRunes, newRunes := []rune(oldName), []rune(newName)
+	prefix := 0
+	for prefix < len(oldRunes) && prefix < len(newRunes) && oldRunes[prefix] == newRunes[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(oldRunes)-prefix && suffix < len(newRunes)-prefix &&
+		oldRunes[len(oldRunes)-1-suffix] == newRunes[len(newRunes)-1-suffix] {
+		suffix++
+	}
+
+	marker := func(name string) string {
+		changed := utf8.RuneCountInString(name) - prefix - suffix
+		if changed == 0 {
+			return ""
+		}
+		return strings.Repeat(" ", prefix+2) + strings.Repeat("^", changed)
+	}
+	lines := []string{"- " + oldName}
+	if m := marker(oldName); m != "" {
+		lines = append(lines, m)
+	}
+	lines = append(lines, "+ "+newName)
+	if m := marker(newName); m != "" {
+		lines = append(lines, m)
+	}
+	return lines
+}
@@ -0,0 +1,28 @@
+package renamer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffLines(t *testing.T) {
+	require.Equal(t, []string{
+		"- AMBPark_Fountain_Buddin_Phonogrifter.wav",
+		"          ^^^^^^^^",
+		"+ AMBPark_Stream_Buddin_Phonogrifter.wav",
+		"          ^^^^^^",
+	}, diffLines(
+		"AMBPark_Fountain_Buddin_Phonogrifter.wav",
+		"AMBPark_Stream_Buddin_Phonogrifter.wav",
+	))
+
+	require.Equal(t, []string{
+		"- AMBPark_Fountain_Buddin_Phonogrifter.wav",
+		"+ AMBPark_Fountain_BuddinFX_Phonogrifter.wav",
+		"                         ^^",
+	}, diffLines(
+		"AMBPark_Fountain_Buddin_Phonogrifter.wav",
+		"AMBPark_Fountain_BuddinFX_Phonogrifter.wav",
+	), "nothing was removed from the old name")
+}
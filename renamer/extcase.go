@@ -0,0 +1,48 @@
+package renamer
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// extUnifier returns how the extension of each file in a batch is cased. It leaves extensions alone
+// unless UnifyExt is set, in which case all of them are given the same case: lowercase with
+// LowerExt, and otherwise the case used by most of the files, preferring lowercase on a tie. A
+// warning is reported when the files don't already agree.
+func (r Renamer) extUnifier(filenames []string) func(string) string {
+	if !r.UnifyExt {
+		return func(ext string) string { return ext }
+	}
+	var (
+		lower, upper, other int
+		spellings           []string
+	)
+	for _, filename := range filenames {
+		ext := filepath.Ext(filename)
+		switch ext {
+		case "":
+			continue
+		case strings.ToLower(ext):
+			lower++
+		case strings.ToUpper(ext):
+			upper++
+		default:
+			other++
+		}
+		if !slices.Contains(spellings, ext) {
+			spellings = append(spellings, ext)
+		}
+	}
+
+	unify, name := strings.ToLower, "lowercase"
+	if !r.LowerExt && upper > lower {
+		unify, name = strings.ToUpper, "uppercase"
+	}
+	if other > 0 || (lower > 0 && upper > 0) {
+		slices.Sort(spellings)
+		fmt.Fprintf(r.Stderr, "Warning: the extensions differ in case (%s); they'll all be %s\n", strings.Join(spellings, ", "), name)
+	}
+	return unify
+}
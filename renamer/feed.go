@@ -0,0 +1,63 @@
+package renamer
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/brettbuddin/ucsrename/ucs"
+)
+
+// DumpFeed writes the category feed to w exactly as fzf is given it, for diagnosing why a CatID is
+// missing from the list or isn't selected as expected. Stderr receives the command fzf runs to read
+// the feed, the options it's given, and any line that wouldn't be parsed back to its own CatID when
+// selected, such as one whose CatID is empty or shared with another category, or that a newline in
+// a custom category file splits in two.
+func (r Renamer) DumpFeed(w io.Writer) error {
+	categories, err := ucs.Categories()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(r.Stderr, "Feed command: %s\n", r.SelfCommand)
+	if len(r.FZFOpts) > 0 {
+		fmt.Fprintf(r.Stderr, "fzf options: %q\n", r.FZFOpts)
+	}
+	seen := map[string]int{}
+	problems := 0
+	line := 1
+	for _, c := range categories {
+		text := ucs.FeedLine(c)
+		if _, err := fmt.Fprintln(w, text); err != nil {
+			return err
+		}
+		first, _, _ := strings.Cut(text, "\n")
+		span := strings.Count(text, "\n") + 1
+
+		var problem string
+		switch got := extractCatID(first); {
+		case c.CatID == "":
+			problem = "has no CatID"
+		case seen[c.CatID] > 0:
+			problem = fmt.Sprintf("repeats the CatID of line %d, so only one of them can be selected", seen[c.CatID])
+		case span > 1:
+			problem = fmt.Sprintf("continues over %d lines, which fzf lists as separate entries", span)
+		case got != c.CatID:
+			problem = fmt.Sprintf("would be selected as %q rather than %q", got, c.CatID)
+		}
+		if _, ok := seen[c.CatID]; !ok {
+			seen[c.CatID] = line
+		}
+		if problem != "" {
+			problems++
+			fmt.Fprintf(r.Stderr, "Line %d %s: %s\n", line, problem, first)
+		}
+		line += span
+	}
+	noun := "problems"
+	if problems == 1 {
+		noun = "problem"
+	}
+	fmt.Fprintf(r.Stderr, "%d categories, %d %s\n", len(categories), problems, noun)
+	return nil
+}
@@ -0,0 +1,55 @@
+package renamer
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/brettbuddin/ucsrename/ucs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDumpFeed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "custom.csv")
+	csv := "AIR,BLOW,AIRBlow,AIR,Air blowing,blow\n" +
+		"AIR,HISS,AIRHiss,AIR,Air hissing,hiss\n" +
+		"AIR,PUFF,AIRBlow,AIR,Air puffing,puff\n"
+	require.NoError(t, os.WriteFile(path, []byte(csv), 0o644))
+	t.Setenv("UCS_CSV_FILE", path)
+
+	var stdout, stderr bytes.Buffer
+	r := Renamer{SelfCommand: "ucsrename -list-categories", Stderr: &stderr}
+	require.NoError(t, r.DumpFeed(&stdout))
+
+	var feed bytes.Buffer
+	require.NoError(t, ucs.WriteFeed(&feed))
+	require.Equal(t, feed.String(), stdout.String(), "the feed is written unchanged")
+	require.Contains(t, stderr.String(), "Feed command: ucsrename -list-categories\n")
+	require.Contains(t, stderr.String(), "Line 2 repeats the CatID of line 1")
+	require.Contains(t, stderr.String(), "3 categories, 1 problem\n")
+}
+
+func TestDumpFeedMultilineField(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "custom.csv")
+	csv := "AIR,BLOW,AIRBlow,AIR,Air blowing,\"blow\nwind\"\n" +
+		"AIR,HISS,AIRHiss,AIR,Air hissing,hiss\n" +
+		"AIR,PUFF,AIRHiss,AIR,Air puffing,puff\n"
+	require.NoError(t, os.WriteFile(path, []byte(csv), 0o644))
+	t.Setenv("UCS_CSV_FILE", path)
+
+	var stdout, stderr bytes.Buffer
+	r := Renamer{Stderr: &stderr}
+	require.NoError(t, r.DumpFeed(&stdout))
+
+	var feed bytes.Buffer
+	require.NoError(t, ucs.WriteFeed(&feed))
+	require.Equal(t, feed.String(), stdout.String(), "the feed is written unchanged")
+
+	// Lines are numbered as they appear in the feed, after the line the newline adds.
+	lines := strings.Split(stdout.String(), "\n")
+	require.Contains(t, stderr.String(), "Line 1 continues over 2 lines, which fzf lists as separate entries: "+lines[0]+"\n")
+	require.Contains(t, stderr.String(), "Line 4 repeats the CatID of line 3, so only one of them can be selected: "+lines[3]+"\n")
+	require.Contains(t, stderr.String(), "3 categories, 2 problems\n")
+}
@@ -0,0 +1,37 @@
+package renamer
+
+import (
+	"io/fs"
+	"os"
+	"time"
+)
+
+// FS is the set of filesystem operations used by Renamer, so that they can be substituted in tests.
+type FS interface {
+	Lstat(name string) (fs.FileInfo, error)
+	Rename(oldpath, newpath string) error
+	ReadDir(name string) ([]fs.DirEntry, error)
+}
+
+// osFS is the host filesystem.
+type osFS struct{}
+
+func (osFS) Lstat(name string) (fs.FileInfo, error)     { return os.Lstat(name) }
+func (osFS) Rename(oldpath, newpath string) error       { return os.Rename(oldpath, newpath) }
+func (osFS) ReadDir(name string) ([]fs.DirEntry, error) { return os.ReadDir(name) }
+
+// filesystem returns the FS in use, defaulting to the host filesystem.
+func (r Renamer) filesystem() FS {
+	if r.FS == nil {
+		return osFS{}
+	}
+	return r.FS
+}
+
+// now returns the current time according to Clock, defaulting to time.Now.
+func (r Renamer) now() time.Time {
+	if r.Clock == nil {
+		return time.Now()
+	}
+	return r.Clock()
+}
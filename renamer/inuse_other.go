@@ -0,0 +1,9 @@
+//go:build !windows
+
+package renamer
+
+// fileInUse reports whether another process holds path open. Renaming open files is permitted on
+// non-Windows platforms, so there is nothing to detect.
+func fileInUse(path string) (bool, error) {
+	return false, nil
+}
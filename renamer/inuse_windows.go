@@ -0,0 +1,28 @@
+//go:build windows
+
+package renamer
+
+import (
+	"errors"
+	"syscall"
+)
+
+const errSharingViolation syscall.Errno = 32
+
+// fileInUse reports whether another process holds path open. Windows refuses to rename open files,
+// so opening the file without sharing is a reliable way of detecting this ahead of time.
+func fileInUse(path string) (bool, error) {
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return false, err
+	}
+	h, err := syscall.CreateFile(p, syscall.GENERIC_READ, 0, nil, syscall.OPEN_EXISTING, syscall.FILE_ATTRIBUTE_NORMAL, 0)
+	if errors.Is(err, errSharingViolation) {
+		return true, nil
+	}
+	if err != nil {
+		// Best-effort: let the rename itself report anything else.
+		return false, nil
+	}
+	return false, syscall.CloseHandle(h)
+}
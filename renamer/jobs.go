@@ -0,0 +1,115 @@
+package renamer
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/brettbuddin/ucsrename/ucs"
+)
+
+// concurrent reports whether a confirmed batch is transferred by several workers. Only copies,
+// embedding and moves into OutputDir are worth spreading out; plain renames are cheap.
+func (r Renamer) concurrent(forceConfirm bool) bool {
+	return r.Jobs > 1 && forceConfirm && (r.Copy || r.Embed || r.OutputDir != "")
+}
+
+// transferResult is the outcome of one rename of a concurrent batch.
+type transferResult struct {
+	warnings []string
+	// output holds what the transfer wrote to Stderr, so that it's reported with the rest of the file.
+	output      bytes.Buffer
+	transferred bool
+	err         error
+}
+
+// transferAll transfers the files of plan using Jobs workers. Warnings are gathered beforehand, one
+// file at a time, and a file whose warnings are an error isn't transferred. Unless KeepGoing is set,
+// no transfer is started after a file fails, as when renaming serially; files that weren't started
+// are neither transferred nor failed.
+func (r Renamer) transferAll(plan []Rename) []*transferResult {
+	results := make([]*transferResult, len(plan))
+	for i, p := range plan {
+		results[i] = &transferResult{}
+		results[i].warnings, results[i].err = r.renameWarnings(p.From, p.To)
+	}
+
+	var (
+		failed int32
+		wg     sync.WaitGroup
+		jobs   = make(chan int)
+	)
+	for w := 0; w < r.Jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				res := results[i]
+				worker := r
+				worker.Stderr = &res.output
+				if res.err = worker.transfer(plan[i].From, plan[i].To); res.err != nil {
+					atomic.StoreInt32(&failed, 1)
+					continue
+				}
+				res.transferred = true
+			}
+		}()
+	}
+	for i, res := range results {
+		if !r.KeepGoing && (res.err != nil || atomic.LoadInt32(&failed) == 1) {
+			break
+		}
+		if res.err == nil {
+			jobs <- i
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
+
+// applyConcurrently carries out a confirmed batch like apply does, with the transfers made by
+// transferAll. Everything else is reported in plan order once the transfers are done, so the output
+// reads just as it would serially. Renamed files are always logged, even after a failure has stopped
+// the batch, so that they can be undone. It returns the Filenames that were renamed.
+func (r Renamer) applyConcurrently(plan []Rename, batchErr *BatchError) []ucs.Filename {
+	var (
+		done    []ucs.Filename
+		stopped bool
+	)
+	failFile := func(filename string, err error) {
+		if stopped {
+			batchErr.Failed++
+			fmt.Fprintf(r.Stderr, "%s: %s\n", filename, err)
+			return
+		}
+		stopped = !r.fail(batchErr, filename, err)
+	}
+	for i, res := range r.transferAll(plan) {
+		p := plan[i]
+		if res.err != nil {
+			failFile(p.From, res.err)
+			continue
+		}
+		if !res.transferred {
+			continue
+		}
+		for _, w := range res.warnings {
+			fmt.Fprintf(r.Stderr, "Warning: %s\n", w)
+		}
+		r.Stderr.Write(res.output.Bytes())
+		batchErr.Renamed++
+		done = append(done, p.Filename)
+		if err := r.logRename(p); err != nil {
+			failFile(p.From, err)
+			continue
+		}
+		if err := r.recordDatabase(p); err != nil {
+			failFile(p.From, err)
+			continue
+		}
+		r.progress(i+1, len(plan), p, true)
+	}
+	return done
+}
@@ -0,0 +1,154 @@
+package renamer
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"time"
+	"unicode/utf8"
+
+	"github.com/brettbuddin/ucsrename/ucs"
+)
+
+// LogEntry is a single line of a rename log, recording the fields a source file was renamed with.
+type LogEntry struct {
+	Time time.Time `json:"time"`
+
+	// Source and Renamed are the base names of the file before and after renaming.
+	Source  string       `json:"source"`
+	Renamed string       `json:"renamed"`
+	Fields  ucs.Filename `json:"fields"`
+
+	// SourceHex holds the raw bytes of Source, hex-encoded, when it isn't valid UTF-8. JSON can't
+	// carry such a name faithfully, so Source alone loses the bytes that were replaced.
+	SourceHex string `json:"sourceHex,omitempty"`
+
+	// Required lists the fields the rename required, when they weren't ucs.DefaultRequired.
+	Required []string `json:"required,omitempty"`
+}
+
+// SourceName returns the original base name, with its raw bytes when they were recorded.
+func (e LogEntry) SourceName() string {
+	if e.SourceHex != "" {
+		if b, err := hex.DecodeString(e.SourceHex); err == nil {
+			return string(b)
+		}
+	}
+	return e.Source
+}
+
+// logRename appends an entry for p to Log, if it's set.
+func (r Renamer) logRename(p Rename) error {
+	if r.Log == nil {
+		return nil
+	}
+	entry := LogEntry{
+		Time:     r.now(),
+		Source:   filepath.Base(p.From),
+		Renamed:  filepath.Base(p.To),
+		Fields:   p.Filename,
+		Required: r.Required,
+	}
+	if !utf8.ValidString(entry.Source) {
+		entry.SourceHex = hex.EncodeToString([]byte(entry.Source))
+	}
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(r.Log, "%s\n", b)
+	return err
+}
+
+// ReadLog reads a rename log written by Renamer, one JSON object per line. Blank lines are ignored.
+func ReadLog(src io.Reader) ([]LogEntry, error) {
+	var (
+		entries []LogEntry
+		line    int
+	)
+	scanner := bufio.NewScanner(src)
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e LogEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// Replay renames the files in dir using the fields recorded in a rename log. Files are matched by
+// their original base name, so a delivery can be redone from a fresh copy of the raw masters. When a
+// source appears in the log more than once, its latest entry is used. Sources missing from dir are
+// reported on Stderr and skipped. The fields of each entry must include those it was required to
+// have when it was logged, or Required for entries that don't record them. A confirmation is
+// required for each file unless forceConfirm is true.
+func (r Renamer) Replay(entries []LogEntry, dir string, forceConfirm bool) error {
+	latest := map[string]int{}
+	var order []string
+	for i, e := range entries {
+		if _, ok := latest[e.SourceName()]; !ok {
+			order = append(order, e.SourceName())
+		}
+		latest[e.SourceName()] = i
+	}
+
+	var plan []Rename
+	for _, source := range order {
+		e := entries[latest[source]]
+		src := filepath.Join(dir, source)
+		_, err := r.filesystem().Lstat(src)
+		if errors.Is(err, fs.ErrNotExist) {
+			fmt.Fprintf(r.Stderr, "Missing: %s\n", e.Source)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		required := e.Required
+		if len(required) == 0 {
+			required = r.requiredFields()
+		}
+		if err := e.Fields.ValidateRequired(required); err != nil {
+			return fmt.Errorf("%s: %w", e.Source, err)
+		}
+		ext := filepath.Ext(e.Renamed)
+		if ext == "" {
+			ext = filepath.Ext(source)
+		}
+		p, err := r.newRename(src, ext, e.Fields)
+		if err != nil {
+			return fmt.Errorf("%s: %w", e.Source, err)
+		}
+		plan = append(plan, p)
+	}
+	if len(plan) == 0 {
+		fmt.Fprintln(r.Stdout, "Nothing to rename")
+		return nil
+	}
+	// The fields of each entry were checked against its own requirements above, and the plan only
+	// needs to check what every name has.
+	checker := r
+	checker.Required = []string{"CatID", "FXName"}
+	if err := checker.checkPlan(plan); err != nil {
+		return err
+	}
+
+	batchErr := &BatchError{Total: len(plan)}
+	if _, ok := r.applyPlan(plan, forceConfirm, batchErr); !ok {
+		return batchErr
+	}
+	if batchErr.Failed > 0 {
+		return batchErr
+	}
+	return nil
+}
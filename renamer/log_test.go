@@ -0,0 +1,106 @@
+package renamer
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplay(t *testing.T) {
+	const renamed = "AMBPark_Fountain_Buddin_Phonogrifter.wav"
+
+	dir := t.TempDir()
+	src := filepath.Join(dir, "foo.wav")
+	require.NoError(t, os.WriteFile(src, nil, 0o644))
+
+	var log bytes.Buffer
+	fixed := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	r := testRenamer(t, "Fountain\n\n")
+	r.Log = &log
+	r.Clock = func() time.Time { return fixed }
+	require.NoError(t, r.Run(src, true))
+
+	entries, err := ReadLog(&log)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, "foo.wav", entries[0].Source)
+	require.Equal(t, renamed, entries[0].Renamed)
+	require.True(t, entries[0].Time.Equal(fixed))
+
+	entries = append(entries, LogEntry{Source: "gone.wav", Renamed: "AMBPark_Gone_Buddin_Phonogrifter.wav", Fields: entries[0].Fields})
+	fresh := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(fresh, "foo.wav"), nil, 0o644))
+	var stderr bytes.Buffer
+	r = Renamer{Stdout: &bytes.Buffer{}, Stderr: &stderr}
+	require.NoError(t, r.Replay(entries, fresh, true))
+	require.FileExists(t, filepath.Join(fresh, renamed))
+	require.Contains(t, stderr.String(), "Missing: gone.wav\n")
+}
+
+func TestReplayRequired(t *testing.T) {
+	const renamed = "AMBPark_Fountain__Phonogrifter.wav"
+
+	dir := t.TempDir()
+	src := filepath.Join(dir, "foo.wav")
+	require.NoError(t, os.WriteFile(src, nil, 0o644))
+
+	var log bytes.Buffer
+	r := testRenamer(t, "Fountain\n\n\n")
+	t.Setenv("UCS_CREATOR_ID", "")
+	r.Required = []string{"CatID", "FXName", "SourceID"}
+	r.Log = &log
+	require.NoError(t, r.Run(src, true))
+	require.FileExists(t, filepath.Join(dir, renamed))
+
+	entries, err := ReadLog(&log)
+	require.NoError(t, err)
+	require.Equal(t, r.Required, entries[0].Required)
+
+	// The log is replayed without -required, as it would be from a later session.
+	fresh := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(fresh, "foo.wav"), nil, 0o644))
+	r = Renamer{Stdout: &bytes.Buffer{}, Stderr: &bytes.Buffer{}}
+	require.NoError(t, r.Replay(entries, fresh, true))
+	require.FileExists(t, filepath.Join(fresh, renamed))
+
+	// Entries that don't record their requirements are checked against Required.
+	entries[0].Required = nil
+	require.NoError(t, os.WriteFile(filepath.Join(fresh, "foo.wav"), nil, 0o644))
+	require.ErrorContains(t, r.Replay(entries, fresh, true), "CreatorID is required")
+	r.Required = []string{"CatID", "FXName", "SourceID"}
+	require.NoError(t, os.Remove(filepath.Join(fresh, renamed)))
+	require.NoError(t, r.Replay(entries, fresh, true))
+	require.FileExists(t, filepath.Join(fresh, renamed))
+}
+
+func TestLogNonUTF8Source(t *testing.T) {
+	const raw = "caf\xe9.wav" // Latin-1, as written by old media
+	dir := t.TempDir()
+	src := filepath.Join(dir, raw)
+	if err := os.WriteFile(src, nil, 0o644); err != nil {
+		t.Skipf("filesystem rejects non-UTF-8 names: %v", err)
+	}
+
+	var log, stderr bytes.Buffer
+	r := testRenamer(t, "Fountain\n\n")
+	r.Log = &log
+	r.Stderr = &stderr
+	require.NoError(t, r.Run(src, true))
+	require.Contains(t, stderr.String(), "isn't valid UTF-8; its original bytes are recorded in the log")
+
+	entries, err := ReadLog(&log)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, "636166e92e776176", entries[0].SourceHex)
+	require.Equal(t, raw, entries[0].SourceName())
+
+	fresh := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(fresh, raw), nil, 0o644))
+	r = Renamer{Stdout: &bytes.Buffer{}, Stderr: &bytes.Buffer{}}
+	require.NoError(t, r.Replay(entries, fresh, true))
+	require.FileExists(t, filepath.Join(fresh, "AMBPark_Fountain_Buddin_Phonogrifter.wav"))
+}
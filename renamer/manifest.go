@@ -0,0 +1,107 @@
+package renamer
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/brettbuddin/ucsrename/ucs"
+)
+
+// ManifestEntry is a single row of a manifest: a source file and the UCS fields it should be renamed
+// with.
+type ManifestEntry struct {
+	Source   string
+	Filename ucs.Filename
+}
+
+// Name returns the filename the source is expected to have after renaming. The extension is taken
+// from the source.
+func (e ManifestEntry) Name() string {
+	return e.Filename.Render(filepath.Ext(e.Source))
+}
+
+// ReadManifest reads a manifest CSV with the columns Source, CatID, FXName, CreatorID, SourceID and,
+// optionally, UserData. A leading header row, whose first column is "Source", is skipped.
+func ReadManifest(src io.Reader) ([]ManifestEntry, error) {
+	reader := csv.NewReader(src)
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) > 0 && strings.EqualFold(records[0][0], "source") {
+		records = records[1:]
+	}
+
+	entries := make([]ManifestEntry, 0, len(records))
+	for i, r := range records {
+		if len(r) != 5 && len(r) != 6 {
+			return nil, fmt.Errorf("manifest row %d: expected 5 or 6 columns, found %d", i+1, len(r))
+		}
+		e := ManifestEntry{
+			Source: r[0],
+			Filename: ucs.Filename{
+				CatID:     r[1],
+				FXName:    r[2],
+				CreatorID: r[3],
+				SourceID:  r[4],
+			},
+		}
+		if len(r) == 6 {
+			e.Filename.UserData = r[5]
+		}
+		if err := e.Filename.Validate(); err != nil {
+			return nil, fmt.Errorf("manifest row %d: %w", i+1, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// Verify checks that dir contains exactly the files named by the manifest entries, with Affix
+// applied. Files that are expected but absent are reported as missing, and files that are present but
+// not expected are reported as unexpected. An error is returned if there are any discrepancies.
+func (r Renamer) Verify(entries []ManifestEntry, dir string) error {
+	dirEntries, err := r.filesystem().ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	present := map[string]bool{}
+	for _, e := range dirEntries {
+		if !e.IsDir() {
+			present[e.Name()] = true
+		}
+	}
+
+	expected := map[string]bool{}
+	var missing, unexpected []string
+	for _, e := range entries {
+		name := r.Affix.Render(e.Filename, filepath.Ext(e.Source))
+		expected[name] = true
+		if !present[name] {
+			missing = append(missing, name)
+		}
+	}
+	for name := range present {
+		if !expected[name] {
+			unexpected = append(unexpected, name)
+		}
+	}
+	slices.Sort(unexpected)
+
+	for _, name := range missing {
+		fmt.Fprintf(r.Stdout, "Missing: %s\n", name)
+	}
+	for _, name := range unexpected {
+		fmt.Fprintf(r.Stdout, "Unexpected: %s\n", name)
+	}
+	if len(missing) > 0 || len(unexpected) > 0 {
+		return fmt.Errorf("%s doesn't match the manifest: %d missing and %d unexpected files", dir, len(missing), len(unexpected))
+	}
+	fmt.Fprintf(r.Stdout, "All %d files present\n", len(entries))
+	return nil
+}
@@ -0,0 +1,52 @@
+package renamer
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadManifest(t *testing.T) {
+	entries, err := ReadManifest(strings.NewReader(
+		"Source,CatID,FXName,CreatorID,SourceID,UserData\n" +
+			"fountain.wav,AMBPark,Fountain,Buddin,Phonogrifter,\n" +
+			"birds.WAV,AMBPark,Birds,Buddin,Phonogrifter,Close\n",
+	))
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	require.Equal(t, "AMBPark_Fountain_Buddin_Phonogrifter.wav", entries[0].Name())
+	require.Equal(t, "AMBPark_Birds_Buddin_Phonogrifter_Close.WAV", entries[1].Name())
+
+	_, err = ReadManifest(strings.NewReader("a.wav,AMBPark,Fountain\n"))
+	require.ErrorContains(t, err, "manifest row 1")
+
+	_, err = ReadManifest(strings.NewReader("a.wav,AMBPark,Foun_tain,Buddin,Phonogrifter\n"))
+	require.ErrorContains(t, err, "FXName")
+}
+
+func TestVerify(t *testing.T) {
+	entries, err := ReadManifest(strings.NewReader(
+		"fountain.wav,AMBPark,Fountain,Buddin,Phonogrifter\n" +
+			"birds.wav,AMBPark,Birds,Buddin,Phonogrifter\n",
+	))
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "AMBPark_Fountain_Buddin_Phonogrifter.wav"), nil, 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "AMBPark_Birds_Buddin_Phonogrifter.wav"), nil, 0o644))
+
+	var stdout bytes.Buffer
+	r := Renamer{Stdout: &stdout}
+	require.NoError(t, r.Verify(entries, dir))
+
+	require.NoError(t, os.Remove(filepath.Join(dir, "AMBPark_Birds_Buddin_Phonogrifter.wav")))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "birds.wav"), nil, 0o644))
+	stdout.Reset()
+	require.ErrorContains(t, r.Verify(entries, dir), "1 missing and 1 unexpected files")
+	require.Contains(t, stdout.String(), "Missing: AMBPark_Birds_Buddin_Phonogrifter.wav\n")
+	require.Contains(t, stdout.String(), "Unexpected: birds.wav\n")
+}
@@ -0,0 +1,263 @@
+package renamer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/brettbuddin/ucsrename/ucs"
+)
+
+// Sizes of the bext fields that are read. Description is followed by Originator.
+const (
+	bextDescriptionSize = 256
+	bextOriginatorSize  = 32
+)
+
+// Layout of the bext origination fields that are written. OriginationDate follows Description,
+// Originator and the 32 byte OriginatorReference, and is followed by OriginationTime. A bext chunk
+// without CodingHistory is bextMinSize bytes.
+const (
+	bextOriginationOffset = bextDescriptionSize + bextOriginatorSize + 32
+	bextDateLayout        = "2006-01-02"
+	bextTimeLayout        = "15:04:05"
+	bextMinSize           = 602
+)
+
+// maxIXMLSize bounds the iXML and LIST chunks that are read, since they're held in memory.
+const maxIXMLSize = 1 << 20
+
+// ixml is the part of an iXML document that carries names. Tools such as Soundminer write the UCS
+// fields into USER.
+type ixml struct {
+	Note string `xml:"NOTE"`
+	User struct {
+		FXName    string `xml:"FXNAME"`
+		CreatorID string `xml:"CREATORID"`
+		Designer  string `xml:"DESIGNER"`
+	} `xml:"USER"`
+}
+
+// readMetadata reads the FXName and CreatorID embedded in the bext, LIST INFO and iXML chunks of a WAV
+// file. iXML takes precedence, then the INFO INAM (title) and IART (artist), and then the bext
+// Description and Originator. Fields that aren't present are left empty.
+func readMetadata(path string) (ucs.Filename, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return ucs.Filename{}, err
+	}
+	defer file.Close()
+
+	var header [12]byte
+	if _, err := io.ReadFull(file, header[:]); err != nil {
+		return ucs.Filename{}, fmt.Errorf("not a WAV file")
+	}
+	if string(header[0:4]) != "RIFF" || string(header[8:12]) != "WAVE" {
+		return ucs.Filename{}, fmt.Errorf("not a WAV file")
+	}
+
+	var bext, info, ixmlFields ucs.Filename
+	for {
+		var chunk [8]byte
+		if _, err := io.ReadFull(file, chunk[:]); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return ucs.Filename{}, fmt.Errorf("reading chunk header: %w", err)
+		}
+		id := string(chunk[0:4])
+		size := int64(binary.LittleEndian.Uint32(chunk[4:8]))
+		// Chunks are padded to an even size.
+		next := size + size%2
+
+		switch {
+		case id == "bext" && size >= bextDescriptionSize+bextOriginatorSize:
+			data := make([]byte, bextDescriptionSize+bextOriginatorSize)
+			if _, err := io.ReadFull(file, data); err != nil {
+				return ucs.Filename{}, fmt.Errorf("reading bext: %w", err)
+			}
+			bext.FXName = cString(data[:bextDescriptionSize])
+			bext.CreatorID = cString(data[bextDescriptionSize:])
+			next -= int64(len(data))
+		case id == "iXML" && size <= maxIXMLSize:
+			data := make([]byte, size)
+			if _, err := io.ReadFull(file, data); err != nil {
+				return ucs.Filename{}, fmt.Errorf("reading iXML: %w", err)
+			}
+			var doc ixml
+			if err := xml.Unmarshal(bytes.TrimRight(data, "\x00"), &doc); err != nil {
+				return ucs.Filename{}, fmt.Errorf("parsing iXML: %w", err)
+			}
+			ixmlFields.FXName = firstNonEmpty(doc.User.FXName, doc.Note)
+			ixmlFields.CreatorID = firstNonEmpty(doc.User.CreatorID, doc.User.Designer)
+			next -= size
+		case id == "LIST" && size <= maxIXMLSize:
+			data := make([]byte, size)
+			if _, err := io.ReadFull(file, data); err != nil {
+				return ucs.Filename{}, fmt.Errorf("reading LIST: %w", err)
+			}
+			// A file may have several LIST chunks, of which only INFO lists are of interest. The
+			// first value found is kept.
+			if len(data) >= 4 && string(data[:4]) == "INFO" {
+				fields := infoFields(data[4:])
+				info.FXName = firstNonEmpty(info.FXName, fields["INAM"])
+				info.CreatorID = firstNonEmpty(info.CreatorID, fields["IART"])
+			}
+			next -= size
+		}
+		if _, err := file.Seek(next, io.SeekCurrent); err != nil {
+			return ucs.Filename{}, err
+		}
+	}
+
+	return ucs.Filename{
+		FXName:    metadataSegment(firstNonEmpty(ixmlFields.FXName, info.FXName, bext.FXName)),
+		CreatorID: metadataSegment(firstNonEmpty(ixmlFields.CreatorID, info.CreatorID, bext.CreatorID)),
+	}, nil
+}
+
+// infoFields returns the text of the subchunks of a LIST INFO chunk, following its INFO type, keyed
+// by their IDs (e.g. INAM). A subchunk that runs past the end of the list ends it.
+func infoFields(data []byte) map[string]string {
+	fields := map[string]string{}
+	for len(data) >= 8 {
+		id := string(data[0:4])
+		size := int(binary.LittleEndian.Uint32(data[4:8]))
+		data = data[8:]
+		// On 32-bit platforms a size over 2GiB wraps negative.
+		if size < 0 || size > len(data) {
+			break
+		}
+		if _, ok := fields[id]; !ok {
+			fields[id] = cString(data[:size])
+		}
+		// Subchunks are padded to an even size, like chunks, but the last one may not be.
+		if size%2 == 1 && size < len(data) {
+			size++
+		}
+		data = data[size:]
+	}
+	return fields
+}
+
+// writeOrigination sets the OriginationDate and OriginationTime of the bext chunk of the WAV file at
+// path to t in UTC, formatted as YYYY-MM-DD and HH:MM:SS. A bext chunk is appended to the file when
+// it doesn't have one, leaving its other fields empty.
+func writeOrigination(path string, t time.Time) error {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var header [12]byte
+	if _, err := io.ReadFull(file, header[:]); err != nil {
+		return fmt.Errorf("not a WAV file")
+	}
+	if string(header[0:4]) != "RIFF" || string(header[8:12]) != "WAVE" {
+		return fmt.Errorf("not a WAV file")
+	}
+
+	t = t.UTC()
+	origination := t.Format(bextDateLayout) + t.Format(bextTimeLayout)
+	offset := int64(len(header))
+	for {
+		var chunk [8]byte
+		if _, err := file.ReadAt(chunk[:], offset); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return fmt.Errorf("reading chunk header: %w", err)
+		}
+		id := string(chunk[0:4])
+		size := int64(binary.LittleEndian.Uint32(chunk[4:8]))
+		if id == "bext" {
+			if size < bextOriginationOffset+int64(len(origination)) {
+				return fmt.Errorf("bext chunk is too short to hold the origination date")
+			}
+			_, err := file.WriteAt([]byte(origination), offset+8+bextOriginationOffset)
+			return err
+		}
+		// Chunks are padded to an even size.
+		offset += 8 + size + size%2
+	}
+
+	// There's no bext chunk, so one is added at the end, where the RIFF size has to account for it.
+	chunk := make([]byte, 8+bextMinSize)
+	copy(chunk, "bext")
+	binary.LittleEndian.PutUint32(chunk[4:8], bextMinSize)
+	copy(chunk[8+bextOriginationOffset:], origination)
+	if _, err := file.WriteAt(chunk, offset); err != nil {
+		return err
+	}
+	var riffSize [4]byte
+	binary.LittleEndian.PutUint32(riffSize[:], uint32(offset+int64(len(chunk))-8))
+	_, err = file.WriteAt(riffSize[:], 4)
+	return err
+}
+
+// embedOrigination writes the origination date and time of the renamed WAV file at path when Embed is
+// set. The file's modification time is used unless EmbedDate is set, and it's restored afterwards,
+// since writing the chunk would otherwise change it. Files that aren't WAV files are left alone.
+func (r Renamer) embedOrigination(path string) error {
+	if !r.Embed || !strings.EqualFold(filepath.Ext(path), ".wav") {
+		return nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	t := r.EmbedDate
+	if t.IsZero() {
+		t = info.ModTime()
+	}
+	if err := writeOrigination(path, t); err != nil {
+		return fmt.Errorf("embedding the origination date in %s: %w", filepath.Base(path), err)
+	}
+	return os.Chtimes(path, accessTime(info), info.ModTime())
+}
+
+// embeddedFields returns the fields embedded in src when FromMetadata is set. Metadata that can't be
+// read is reported as a warning, and the fields are prompted for as usual.
+func (r Renamer) embeddedFields(src string) ucs.Filename {
+	if !r.FromMetadata {
+		return ucs.Filename{}
+	}
+	f, err := readMetadata(src)
+	if err != nil {
+		fmt.Fprintf(r.Stderr, "Warning: can't read the metadata of %s: %s\n", src, err)
+		return ucs.Filename{}
+	}
+	return f
+}
+
+// metadataSegment turns embedded text into a filename segment. Underscores, which recorders are free
+// to use, are treated as spaces.
+func metadataSegment(s string) string {
+	seg, _ := ucs.SanitizeSegment(strings.ReplaceAll(s, "_", " "))
+	return seg
+}
+
+// cString returns the text of a NUL-padded fixed-size field.
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return strings.TrimSpace(string(b))
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,185 @@
+package renamer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// writeWAV writes a WAV file made of the given chunks, in order.
+func writeWAV(t *testing.T, path string, chunks ...[2]string) {
+	var body bytes.Buffer
+	body.WriteString("WAVE")
+	for _, c := range chunks {
+		body.WriteString(c[0])
+		binary.Write(&body, binary.LittleEndian, uint32(len(c[1])))
+		body.WriteString(c[1])
+		if len(c[1])%2 == 1 {
+			body.WriteByte(0)
+		}
+	}
+	var file bytes.Buffer
+	file.WriteString("RIFF")
+	binary.Write(&file, binary.LittleEndian, uint32(body.Len()))
+	file.Write(body.Bytes())
+	require.NoError(t, os.WriteFile(path, file.Bytes(), 0o644))
+}
+
+// bextChunk returns a bext chunk with the given Description and Originator.
+func bextChunk(description, originator string) [2]string {
+	data := make([]byte, 602)
+	copy(data, description)
+	copy(data[bextDescriptionSize:], originator)
+	return [2]string{"bext", string(data)}
+}
+
+// listChunk returns a LIST chunk of the given type holding the given subchunks.
+func listChunk(listType string, subchunks ...[2]string) [2]string {
+	var data bytes.Buffer
+	data.WriteString(listType)
+	for _, c := range subchunks {
+		data.WriteString(c[0])
+		binary.Write(&data, binary.LittleEndian, uint32(len(c[1])))
+		data.WriteString(c[1])
+		if len(c[1])%2 == 1 {
+			data.WriteByte(0)
+		}
+	}
+	return [2]string{"LIST", data.String()}
+}
+
+func TestReadMetadata(t *testing.T) {
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "bext.wav")
+	writeWAV(t, path, [2]string{"fmt ", "0123456789abcdef"}, bextChunk("Central park_fountain", "Buddin"), [2]string{"data", "abc"})
+	f, err := readMetadata(path)
+	require.NoError(t, err)
+	require.Equal(t, "Central-park-fountain", f.FXName)
+	require.Equal(t, "Buddin", f.CreatorID)
+
+	path = filepath.Join(dir, "ixml.wav")
+	writeWAV(t, path,
+		bextChunk("Description", "Recorder"),
+		[2]string{"data", "abcd"},
+		[2]string{"iXML", "<BWFXML><NOTE>Fountain</NOTE><USER><DESIGNER>Brett</DESIGNER></USER></BWFXML>\x00"},
+	)
+	f, err = readMetadata(path)
+	require.NoError(t, err)
+	require.Equal(t, "Fountain", f.FXName, "iXML takes precedence")
+	require.Equal(t, "Brett", f.CreatorID)
+
+	path = filepath.Join(dir, "info.wav")
+	writeWAV(t, path,
+		bextChunk("Description", "Recorder"),
+		listChunk("adtl", [2]string{"labl", "Marker"}),
+		listChunk("INFO", [2]string{"ICMT", "Windy"}, [2]string{"INAM", "Rain on tin"}),
+		listChunk("INFO", [2]string{"INAM", "Ignored"}, [2]string{"IART", "Brett"}),
+		[2]string{"data", "abcd"},
+	)
+	f, err = readMetadata(path)
+	require.NoError(t, err)
+	require.Equal(t, "Rain-on-tin", f.FXName, "INFO takes precedence over bext, and the first INAM wins")
+	require.Equal(t, "Brett", f.CreatorID, "later LIST chunks are read too")
+
+	path = filepath.Join(dir, "ixml-info.wav")
+	writeWAV(t, path,
+		listChunk("INFO", [2]string{"INAM", "Rain"}, [2]string{"IART", "Brett"}),
+		[2]string{"iXML", "<BWFXML><NOTE>Fountain</NOTE></BWFXML>"},
+	)
+	f, err = readMetadata(path)
+	require.NoError(t, err)
+	require.Equal(t, "Fountain", f.FXName, "iXML takes precedence over INFO")
+	require.Equal(t, "Brett", f.CreatorID)
+
+	path = filepath.Join(dir, "plain.wav")
+	require.NoError(t, os.WriteFile(path, []byte("not a wav"), 0o644))
+	_, err = readMetadata(path)
+	require.ErrorContains(t, err, "not a WAV file")
+}
+
+func TestRunFromMetadata(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "take1.wav")
+	writeWAV(t, path, bextChunk("Fountain", "Recordist"), [2]string{"data", ""})
+
+	r := testRenamer(t, "\n")
+	r.FromMetadata = true
+	require.NoError(t, r.Run(path, true))
+	require.FileExists(t, filepath.Join(dir, "AMBPark_Fountain_Recordist_Phonogrifter.wav"))
+
+	path = filepath.Join(dir, "take2.wav")
+	require.NoError(t, os.WriteFile(path, nil, 0o644))
+	r = testRenamer(t, "Birds\n\n")
+	r.FromMetadata = true
+	require.NoError(t, r.Run(path, true), "unreadable metadata falls back to prompting")
+	require.FileExists(t, filepath.Join(dir, "AMBPark_Birds_Buddin_Phonogrifter.wav"))
+	require.Contains(t, r.Stderr.(*bytes.Buffer).String(), "can't read the metadata")
+}
+
+// origination returns the OriginationDate and OriginationTime of the bext chunk in the WAV file at
+// path, after checking that the RIFF size matches the file.
+func origination(t *testing.T, path string) string {
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, len(b)-8, int(binary.LittleEndian.Uint32(b[4:8])), "RIFF size")
+	i := bytes.Index(b, []byte("bext"))
+	require.GreaterOrEqual(t, i, 0)
+	start := i + 8 + bextOriginationOffset
+	return string(b[start : start+18])
+}
+
+func TestWriteOrigination(t *testing.T) {
+	dir := t.TempDir()
+	at := time.Date(2024, 5, 1, 10, 30, 0, 0, time.FixedZone("EST", -5*60*60))
+
+	path := filepath.Join(dir, "bext.wav")
+	writeWAV(t, path, bextChunk("Fountain", "Buddin"), [2]string{"data", "abc"})
+	require.NoError(t, writeOrigination(path, at))
+	require.Equal(t, "2024-05-0115:30:00", origination(t, path), "written in UTC")
+	f, err := readMetadata(path)
+	require.NoError(t, err)
+	require.Equal(t, "Fountain", f.FXName)
+
+	path = filepath.Join(dir, "nobext.wav")
+	writeWAV(t, path, [2]string{"fmt ", "0123456789abcdef"}, [2]string{"data", "abc"})
+	require.NoError(t, writeOrigination(path, at))
+	require.Equal(t, "2024-05-0115:30:00", origination(t, path), "a bext chunk is added")
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Contains(t, string(b), "data\x03\x00\x00\x00abc\x00bext", "the chunk follows the padded data")
+
+	path = filepath.Join(dir, "short.wav")
+	writeWAV(t, path, [2]string{"bext", "too short"})
+	require.ErrorContains(t, writeOrigination(path, at), "too short")
+}
+
+func TestRunEmbed(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "take1.wav")
+	writeWAV(t, path, bextChunk("Fountain", "Recordist"), [2]string{"data", ""})
+	mtime := time.Date(2023, 12, 24, 23, 59, 58, 0, time.UTC)
+	require.NoError(t, os.Chtimes(path, mtime, mtime))
+
+	r := testRenamer(t, "Fountain\n\n")
+	r.Embed = true
+	require.NoError(t, r.Run(path, true))
+	renamed := filepath.Join(dir, "AMBPark_Fountain_Buddin_Phonogrifter.wav")
+	require.Equal(t, "2023-12-2423:59:58", origination(t, renamed))
+	info, err := os.Stat(renamed)
+	require.NoError(t, err)
+	require.True(t, info.ModTime().Equal(mtime), "the modification time is kept")
+
+	path = filepath.Join(dir, "take2.wav")
+	writeWAV(t, path, [2]string{"data", ""})
+	r = testRenamer(t, "Birds\n\n")
+	r.Embed = true
+	r.EmbedDate = time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, r.Run(path, true))
+	require.Equal(t, "2024-05-0100:00:00", origination(t, filepath.Join(dir, "AMBPark_Birds_Buddin_Phonogrifter.wav")))
+}
@@ -0,0 +1,57 @@
+package renamer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/brettbuddin/ucsrename/ucs"
+)
+
+// pickerResults is the number of matches listed by the builtin picker.
+const pickerResults = 10
+
+// pickCatID is a builtin alternative to fzf for selecting a CatID. It repeatedly asks for a search
+// query and lists the best matches, numbered, until one is chosen by its number. Any other answer
+// is taken as a new query, so the search can be refined. query, if not empty, is searched first.
+func (r Renamer) pickCatID(query string) (string, error) {
+	var matches []ucs.Match
+	for {
+		if query != "" {
+			var err error
+			matches, err = ucs.Search(query)
+			if err != nil {
+				return "", err
+			}
+			if len(matches) > pickerResults {
+				matches = matches[:pickerResults]
+			}
+			if len(matches) == 0 {
+				fmt.Fprintf(r.Stdout, "No categories match %q\n", query)
+			}
+			for i, m := range matches {
+				c := m.Category
+				fmt.Fprintf(r.Stdout, "%3d. %s: %s %s\n", i+1, c.CatID, c.Category, c.SubCategory)
+			}
+		}
+
+		if len(matches) > 0 {
+			fmt.Fprint(r.Stdout, "Pick a number, or search again: ")
+		} else {
+			fmt.Fprint(r.Stdout, "Search categories: ")
+		}
+		text, err := readLine(r.Stdin)
+		if err != nil {
+			return "", err
+		}
+		text = strings.TrimSpace(text)
+		if n, err := strconv.Atoi(text); err == nil && len(matches) > 0 {
+			if n < 1 || n > len(matches) {
+				fmt.Fprintf(r.Stderr, "Invalid: pick a number from 1 to %d\n", len(matches))
+				continue
+			}
+			return matches[n-1].Category.CatID, nil
+		}
+		query = text
+	}
+}
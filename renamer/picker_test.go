@@ -0,0 +1,33 @@
+package renamer
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPickCatID(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	r := Renamer{
+		Stdin:  strings.NewReader("zzzz\nAMBPark\n0\n1\n"),
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	catID, err := r.pickCatID("")
+	require.NoError(t, err)
+	require.Equal(t, "AMBPark", catID)
+	require.Contains(t, stdout.String(), `No categories match "zzzz"`)
+	require.Contains(t, stdout.String(), "  1. AMBPark: AMBIENCE PARK\n")
+	require.Contains(t, stderr.String(), "Invalid: pick a number")
+
+	r.Stdin = strings.NewReader("1\n")
+	catID, err = r.pickCatID("AMBPark")
+	require.NoError(t, err)
+	require.Equal(t, "AMBPark", catID, "the initial query is searched first")
+
+	r.Stdin = strings.NewReader("")
+	_, err = r.pickCatID("")
+	require.Error(t, err)
+}
@@ -0,0 +1,105 @@
+package renamer
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/brettbuddin/ucsrename/ucs"
+)
+
+// Plan is the full set of renames a batch intends to make, so that it can be validated and
+// previewed before anything is renamed.
+type Plan struct {
+	Renames []Rename
+
+	// MaxLength limits the length of each new name, in bytes, when it's positive.
+	MaxLength int
+
+	// Required lists the fields every name must have. ucs.DefaultRequired is used when it's empty.
+	Required []string
+
+	// Overwrite allows new names that already exist on disk, which are otherwise reported by
+	// Validate.
+	Overwrite bool
+
+	// FS is checked for existing names. The host filesystem is used when it's nil.
+	FS FS
+}
+
+// newPlan returns a Plan of renames, validated according to the settings of r. Existing files may be
+// overwritten, since they're warned about when each rename is confirmed.
+func (r Renamer) newPlan(renames []Rename) Plan {
+	return Plan{
+		Renames:   renames,
+		MaxLength: r.MaxLength,
+		Required:  r.Required,
+		Overwrite: true,
+		FS:        r.FS,
+	}
+}
+
+// Validate checks the plan without changing anything, returning every problem found: fields that are
+// missing or invalid, names over MaxLength, renames that collide within the plan and, unless
+// Overwrite is set, new names that already exist on disk.
+func (p Plan) Validate() []error {
+	required := p.Required
+	if len(required) == 0 {
+		required = ucs.DefaultRequired
+	}
+	fsys := p.FS
+	if fsys == nil {
+		fsys = osFS{}
+	}
+
+	var errs []error
+	for _, rn := range p.Renames {
+		source := filepath.Base(rn.From)
+		if err := rn.Filename.ValidateRequired(required); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", source, err))
+		}
+		name := filepath.Base(rn.To)
+		if p.MaxLength > 0 && len(name) > p.MaxLength {
+			errs = append(errs, fmt.Errorf("%s: %s is %d characters, exceeding the limit of %d", source, name, len(name), p.MaxLength))
+		}
+		if !p.Overwrite {
+			if err := checkTarget(fsys, rn); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", source, err))
+			}
+		}
+	}
+	for _, c := range planCollisions(p.Renames) {
+		errs = append(errs, errors.New(c))
+	}
+	return errs
+}
+
+// checkTarget reports a new name that's already taken by a file other than the one being renamed.
+func checkTarget(fsys FS, rn Rename) error {
+	dstInfo, err := fsys.Lstat(rn.To)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	srcInfo, err := fsys.Lstat(rn.From)
+	if err == nil && os.SameFile(srcInfo, dstInfo) {
+		return nil
+	}
+	return fmt.Errorf("%s already exists", filepath.Base(rn.To))
+}
+
+// checkPlan validates renames as a Plan configured by r, reporting each problem on Stderr.
+func (r Renamer) checkPlan(renames []Rename) error {
+	errs := r.newPlan(renames).Validate()
+	for _, err := range errs {
+		fmt.Fprintln(r.Stderr, err)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("found %d problems with the planned renames; nothing was renamed", len(errs))
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package renamer
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/brettbuddin/ucsrename/ucs"
+	"github.com/stretchr/testify/require"
+)
+
+// mapFS is an in-memory FS for checking plans without touching disk.
+type mapFS struct {
+	fstest.MapFS
+}
+
+func (m mapFS) Lstat(name string) (fs.FileInfo, error) { return fs.Stat(m.MapFS, name) }
+func (m mapFS) Rename(oldpath, newpath string) error   { return errors.ErrUnsupported }
+
+func TestPlanValidate(t *testing.T) {
+	fountain := ucs.Filename{CatID: "AMBPark", FXName: "Fountain", CreatorID: "Buddin", SourceID: "Phonogrifter"}
+	noSource := fountain
+	noSource.FXName = "Birds"
+	noSource.SourceID = ""
+	existing := fountain
+	existing.FXName = "Rain"
+
+	fsys := mapFS{fstest.MapFS{
+		"dir/a.wav": {}, "dir/b.wav": {}, "dir/c.wav": {}, "dir/d.wav": {},
+		"dir/AMBPark_Rain_Buddin_Phonogrifter.wav": {},
+	}}
+	p := Plan{
+		Renames: []Rename{
+			{From: "dir/a.wav", To: "dir/AMBPark_Fountain_Buddin_Phonogrifter.wav", Filename: fountain},
+			{From: "dir/b.wav", To: "dir/AMBPark_Fountain_Buddin_Phonogrifter.wav", Filename: fountain},
+			{From: "dir/c.wav", To: "dir/AMBPark_Birds_Buddin.wav", Filename: noSource},
+			{From: "dir/d.wav", To: "dir/AMBPark_Rain_Buddin_Phonogrifter.wav", Filename: existing},
+		},
+		MaxLength: 39,
+		FS:        fsys,
+	}
+
+	var msgs []string
+	for _, err := range p.Validate() {
+		msgs = append(msgs, err.Error())
+	}
+	require.ElementsMatch(t, []string{
+		"a.wav: AMBPark_Fountain_Buddin_Phonogrifter.wav is 40 characters, exceeding the limit of 39",
+		"b.wav: AMBPark_Fountain_Buddin_Phonogrifter.wav is 40 characters, exceeding the limit of 39",
+		"c.wav: SourceID is required",
+		"d.wav: AMBPark_Rain_Buddin_Phonogrifter.wav already exists",
+		"Collision: a.wav, b.wav would all be renamed to AMBPark_Fountain_Buddin_Phonogrifter.wav",
+	}, msgs)
+
+	p.MaxLength = 0
+	p.Overwrite = true
+	p.Required = []string{"CatID", "FXName"}
+	p.Renames = p.Renames[2:]
+	require.Empty(t, p.Validate())
+}
@@ -0,0 +1,103 @@
+package renamer
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Prompter asks the questions needed to name a file. The Renamer decides whether a question needs to
+// be asked at all, from its presets, the environment and NoPrompt, and validates the answers; a
+// Prompter only asks.
+type Prompter interface {
+	// Select asks for a CatID, with query as the initial search.
+	Select(query string) (string, error)
+
+	// Input asks for a single line of text, introduced by label.
+	Input(label string) (string, error)
+
+	// Confirm asks a yes or no question.
+	Confirm(question string) (bool, error)
+}
+
+// prompter returns the Prompter in use, defaulting to the terminal.
+func (r Renamer) prompter() Prompter {
+	if r.Prompter == nil {
+		return terminalPrompter{r}
+	}
+	return r.Prompter
+}
+
+// terminalPrompter asks questions on Stdout and reads the answers from Stdin. CatIDs are selected
+// with fzf, or the builtin picker when fzf isn't available.
+type terminalPrompter struct {
+	r Renamer
+}
+
+func (p terminalPrompter) Select(query string) (string, error) {
+	return p.r.selectCatID(query)
+}
+
+func (p terminalPrompter) Input(label string) (string, error) {
+	fmt.Fprintf(p.r.Stdout, "%s: ", label)
+	return readLine(p.r.Stdin)
+}
+
+// Confirm asks until the answer is y or n. An empty answer is no, unless DefaultYes is set.
+func (p terminalPrompter) Confirm(question string) (bool, error) {
+	choices := "(y/N)"
+	if p.r.DefaultYes {
+		choices = "(Y/n)"
+	}
+	for {
+		fmt.Fprintf(p.r.Stdout, "%s %s ", question, choices)
+		answer, err := readLine(p.r.Stdin)
+		if err != nil {
+			return false, err
+		}
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "y", "yes":
+			return true, nil
+		case "n", "no":
+			return false, nil
+		case "":
+			return p.r.DefaultYes, nil
+		default:
+			fmt.Fprintln(p.r.Stderr, "Invalid: answer y or n")
+		}
+	}
+}
+
+// ScriptedPrompter answers questions from fixed lists, in order, which makes the whole renaming flow
+// testable without a terminal or fzf. Running out of answers is an error.
+type ScriptedPrompter struct {
+	Selections []string
+	Inputs     []string
+	Confirms   []bool
+}
+
+func (p *ScriptedPrompter) Select(query string) (string, error) {
+	if len(p.Selections) == 0 {
+		return "", fmt.Errorf("no scripted CatID left to select for %q", query)
+	}
+	s := p.Selections[0]
+	p.Selections = p.Selections[1:]
+	return s, nil
+}
+
+func (p *ScriptedPrompter) Input(label string) (string, error) {
+	if len(p.Inputs) == 0 {
+		return "", fmt.Errorf("no scripted input left for %s", label)
+	}
+	s := p.Inputs[0]
+	p.Inputs = p.Inputs[1:]
+	return s, nil
+}
+
+func (p *ScriptedPrompter) Confirm(question string) (bool, error) {
+	if len(p.Confirms) == 0 {
+		return false, fmt.Errorf("no scripted answer left for %q", question)
+	}
+	ok := p.Confirms[0]
+	p.Confirms = p.Confirms[1:]
+	return ok, nil
+}
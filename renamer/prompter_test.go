@@ -0,0 +1,39 @@
+package renamer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestScriptedPrompter(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "fountain.wav")
+	require.NoError(t, os.WriteFile(path, nil, 0o644))
+
+	r := testRenamer(t, "")
+	t.Setenv("UCS_CAT_ID", "")
+	t.Setenv("UCS_SOURCE_ID", "")
+	r.Prompter = &ScriptedPrompter{
+		Selections: []string{"AMBPark"},
+		Inputs:     []string{"Central Park Fountain", "Phonogrifter", "close"},
+		Confirms:   []bool{true},
+	}
+	require.NoError(t, r.Run(path, false))
+	require.FileExists(t, filepath.Join(dir, "AMBPark_Central-Park-Fountain_Buddin_Phonogrifter_close.wav"))
+
+	path = filepath.Join(dir, "birds.wav")
+	require.NoError(t, os.WriteFile(path, nil, 0o644))
+	r.Prompter = &ScriptedPrompter{
+		Selections: []string{"AMBPark"},
+		Inputs:     []string{"Birds", "Phonogrifter", ""},
+		Confirms:   []bool{false},
+	}
+	require.NoError(t, r.Run(path, false))
+	require.FileExists(t, path, "declined")
+
+	r.Prompter = &ScriptedPrompter{Selections: []string{"AMBPark"}}
+	require.ErrorContains(t, r.Run(path, false), "no scripted input left for FXName")
+}
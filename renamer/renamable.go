@@ -0,0 +1,34 @@
+package renamer
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// DefaultExtensions are the file name extensions considered renamable when no allowlist is given.
+var DefaultExtensions = []string{".wav", ".bwf", ".aif", ".aiff", ".flac", ".mp3", ".ogg", ".m4a", ".caf"}
+
+// IsRenamable reports whether the file at path looks like something that should be given a UCS name.
+// Hidden files (such as .DS_Store) and files without an extension are not. Otherwise the extension
+// must appear in allowlist, compared case-insensitively and with or without the leading dot;
+// DefaultExtensions is used when allowlist is empty.
+//
+// It's intended for files discovered by expanding patterns or walking directories. Files named
+// explicitly by the user needn't be checked.
+func IsRenamable(path string, allowlist []string) bool {
+	base := filepath.Base(path)
+	if strings.HasPrefix(base, ".") {
+		return false
+	}
+	ext := filepath.Ext(base)
+	if ext == "" {
+		return false
+	}
+	if len(allowlist) == 0 {
+		allowlist = DefaultExtensions
+	}
+	return slices.ContainsFunc(allowlist, func(allowed string) bool {
+		return strings.EqualFold(ext, "."+strings.TrimPrefix(allowed, "."))
+	})
+}
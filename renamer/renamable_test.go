@@ -0,0 +1,19 @@
+package renamer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsRenamable(t *testing.T) {
+	require.True(t, IsRenamable("dir/foo.wav", nil))
+	require.True(t, IsRenamable("dir/foo.WAV", nil))
+	require.False(t, IsRenamable("dir/.DS_Store", nil))
+	require.False(t, IsRenamable("dir/notes.txt", nil))
+	require.False(t, IsRenamable("dir/README", nil))
+
+	require.True(t, IsRenamable("foo.rx2", []string{"rx2"}))
+	require.True(t, IsRenamable("foo.rx2", []string{".RX2"}))
+	require.False(t, IsRenamable("foo.wav", []string{"rx2"}))
+}
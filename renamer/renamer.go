@@ -2,113 +2,677 @@
 package renamer
 
 import (
-	"bufio"
 	"bytes"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"slices"
 	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/brettbuddin/ucsrename/ucs"
 )
 
 func NewDefault() (Renamer, error) {
-	fzfExec, err := exec.LookPath("fzf")
+	// fzf is only needed to select a CatID, so its absence isn't an error until then.
+	fzfExec, _ := exec.LookPath("fzf")
+	fzfOpts, err := splitArgs(os.Getenv("UCS_FZF_OPTS"))
+	if err != nil {
+		return Renamer{}, fmt.Errorf("UCS_FZF_OPTS: %w", err)
+	}
+	userCategories, err := ucs.UserCategories()
 	if err != nil {
 		return Renamer{}, err
 	}
 
 	return Renamer{
-		SelfCommand: os.Args[0],
-		Stdin:       os.Stdin,
-		Stdout:      os.Stdout,
-		Stderr:      os.Stderr,
-		FZFExec:     fzfExec,
+		SelfCommand:         shellQuote(os.Args[0]) + " -list-categories",
+		UserCategoryCommand: shellQuote(os.Args[0]) + " -list-user-categories",
+		UserCategories:      userCategories,
+		Stdin:               os.Stdin,
+		Stdout:              os.Stdout,
+		Stderr:              os.Stderr,
+		FZFExec:             fzfExec,
+		FZFOpts:             fzfOpts,
+		DefaultExt:          os.Getenv("UCS_DEFAULT_EXT"),
 	}, nil
 }
 
 // Renamer is an interactive renamer for UCS filenames.
 type Renamer struct {
+	// SelfCommand is the shell command fzf runs to list the categories to choose from.
 	SelfCommand string
-	Stdin       io.Reader
-	Stdout      io.Writer
-	Stderr      io.Writer
-	FZFExec     string
+
+	// UserCategories is a team's own taxonomy, offered for the optional UserCategory field after the
+	// CatID is selected. The field isn't prompted for when it's empty. UserCategoryCommand is the
+	// shell command fzf runs to list them.
+	UserCategories      []ucs.UserCategory
+	UserCategoryCommand string
+
+	// BracketUserCategory renders the UserCategory in the vendor bracket notation, ahead of the CatID
+	// (e.g. [Dusk]AMBPark_Fountain_Buddin_Phonogrifter.wav).
+	BracketUserCategory bool
+
+	Stdin   io.Reader
+	Stdout  io.Writer
+	Stderr  io.Writer
+	FZFExec string
+
+	// FZFOpts are extra arguments appended to the fzf command line. The CatID is extracted from the
+	// text preceding the first ":" of the selected line, so options that change what fzf prints
+	// (--multi, --print-query, --expect, --print0, --read0, --filter) are unsupported.
+	FZFOpts []string
+
+	// FXNameFilter is a command that FXName is piped through, such as a house-style normalizer. Its
+	// output replaces the FXName and is sanitized again. The command is split into arguments like
+	// UCS_FZF_OPTS, and isn't run by a shell.
+	FXNameFilter string
+
+	// UserDataTokens prompts for UserData as comma-separated tokens that are sanitized individually
+	// and joined with dashes.
+	UserDataTokens bool
+
+	// SpaceChar replaces runs of whitespace inside a field, and is a dash when empty. With
+	// RemoveSpaces, whitespace is removed instead, so "Door Slam" becomes DoorSlam.
+	SpaceChar    string
+	RemoveSpaces bool
+
+	// TrimUserData, when positive, truncates UserData to at most that many characters, preferring to
+	// cut at a dash so that words are kept whole.
+	TrimUserData int
+
+	// FollowSymlinks renames the target of a symbolic link rather than the link itself.
+	FollowSymlinks bool
+
+	// Quiet suppresses the progress reported while renaming several files. Verbose extends it with
+	// the fields of each rendered filename.
+	Quiet   bool
+	Verbose bool
+
+	// Report writes a FieldReport of the files renamed by a batch to Stderr once it's done, as a
+	// table or, with ReportJSON, as JSON.
+	Report     bool
+	ReportJSON bool
+
+	// QuietSkips replaces the message reported for each skipped file with a count of them at the end,
+	// keeping re-runs over a mostly renamed library readable.
+	QuietSkips bool
+
+	// LowerExt lowercases the extension carried over from the source file (e.g. .WAV becomes .wav).
+	LowerExt bool
+
+	// DefaultExt is the extension given to files that have none, such as files that lost it in
+	// transfer. Without it, renaming such a file is an error.
+	DefaultExt string
+
+	// UnifyExt gives the extensions of a batch the same case, such as when .wav and .WAV files from
+	// different recorders are renamed together. The case most of the files use is chosen, unless
+	// LowerExt is set.
+	UnifyExt bool
+
+	// KeepGoing continues renaming the remaining files after one fails.
+	KeepGoing bool
+
+	// ConfirmOnce confirms a batch as a whole, after listing every planned rename, rather than
+	// confirming each file as it's renamed.
+	ConfirmOnce bool
+
+	// DefaultYes makes confirmation the default when the user answers with an empty line.
+	DefaultYes bool
+
+	// GroupStems prompts once for files that share a stem when renaming several files, such as
+	// foo.wav, foo.L.wav and foo.R.wav. The part of each name following the stem (L and R) is
+	// appended to its UserData.
+	GroupStems bool
+
+	// ReuseFXName lets the FXName of the previous file be reused when renaming several files, by
+	// leaving the answer empty. A take token (take2, take3, ...) is appended to the UserData of each
+	// file that reuses it.
+	ReuseFXName bool
+
+	// Sequence, when positive, prompts for the fields once when renaming several files and appends a
+	// counter starting at Sequence to the FXName of each file (e.g. Door-Slam-01 to Door-Slam-10). The
+	// counter is zero-padded to the width of the last number, so the names sort naturally. Files
+	// sharing a stem share a number when GroupStems is set.
+	Sequence int
+
+	// OrderUserData numbers each file of a batch by its position when the batch is sorted by path,
+	// placing the number first in UserData (e.g. 01-close), so that the names keep the play order of
+	// the source folder whatever their FXNames. The number is zero-padded to the width of the batch
+	// size. Files sharing a stem share a number when GroupStems is set.
+	OrderUserData bool
+
+	// ShareFields reuses the CatID, UserCategory, CreatorID and SourceID given for the first file of a
+	// batch for the rest of it, so that only FXName and UserData are asked for each file.
+	ShareFields bool
+
+	// FromMetadata pre-fills FXName and CreatorID from the bext, LIST INFO and iXML chunks of WAV
+	// files, so that only the fields that are missing are prompted for. Embedded values take
+	// precedence over the environment, but not over Preset.
+	FromMetadata bool
+
+	// Prompter asks the questions. The terminal, using Stdin, Stdout and fzf, is used when it's nil.
+	Prompter Prompter
+
+	// Interactive allows an invalid CatID from -cat or UCS_CAT_ID to be corrected with fzf, rather
+	// than being an error.
+	Interactive bool
+
+	// MaxLength limits the length of rendered filenames, in bytes. The remaining budget is shown when
+	// prompting for FXName. Zero means no limit.
+	MaxLength int
+
+	// Required names the fields that must be given, as returned by ucs.ParseRequired. The others may
+	// be left empty, and drop out of the filename like UserData. ucs.DefaultRequired is used when it's
+	// empty.
+	Required []string
+
+	// Preset holds field values used for every file instead of prompting. They take precedence over
+	// the UCS_* environment variables.
+	Preset ucs.Filename
+
+	// NoPrompt disables prompting entirely. Required fields must be provided by Preset or the
+	// environment, otherwise renaming fails rather than waiting for input.
+	NoPrompt bool
+
+	// Responses, when set, answers the field prompts in order, one line per prompt, instead of Stdin.
+	// An empty line leaves an optional field empty. The CatID is still selected with fzf unless it's
+	// provided by Preset or the environment.
+	Responses io.Reader
+
+	// Copy copies files to their new names instead of renaming them, leaving the originals in place.
+	// The access and modification times of the original are preserved on the copy.
+	Copy bool
+
+	// Link creates a hardlink at each new name instead of renaming, so a library can be given more
+	// than one organized view without duplicating its files. The original names are left in place.
+	Link bool
+
+	// OutputDir, when set, is where renamed files are moved (or copied or linked) to, instead of
+	// staying in their own directories. With KeepStructure, the path of each file's directory relative
+	// to StructureRoot, or to the working directory when it's empty, is recreated under OutputDir.
+	OutputDir     string
+	KeepStructure bool
+	StructureRoot string
+
+	// Touch sets the modification time of each renamed or copied file to the current time.
+	Touch bool
+
+	// Jobs is the number of files copied, embedded or moved into OutputDir at once by a confirmed
+	// batch. Fields are still gathered one file at a time, and each file is reported in order.
+	Jobs int
+
+	// Embed writes the BWF OriginationDate and OriginationTime into the bext chunk of each renamed
+	// WAV file, from its modification time or from EmbedDate when it's set, in UTC. A bext chunk is
+	// added to files that don't have one.
+	Embed     bool
+	EmbedDate time.Time
+
+	// Diff previews batch changes as aligned old and new names with the changed portion marked,
+	// rather than as "old -> new".
+	Diff bool
+
+	// Affix is placed around every new filename. It produces names that don't follow the UCS
+	// standard, for archives that require them.
+	Affix ucs.Affix
+
+	// Extensions is the allowlist of file name extensions passed to IsRenamable when files are found
+	// by reading a directory. DefaultExtensions is used when it's empty.
+	Extensions []string
+
+	// Log, when set, receives a JSON line for every file renamed, recording its original name and
+	// fields. The log can be replayed later with Replay.
+	Log io.Writer
+
+	// Database, when set, receives a CSV row for every file renamed, with the columns a DAM such as
+	// Soundminer imports: the new file name, the UCS fields and the category they belong to. The header
+	// is written separately, with WriteDatabaseHeader.
+	Database io.Writer
+
+	// FS performs filesystem operations, and Clock provides the current time. The host filesystem
+	// and time.Now are used when they're nil.
+	FS    FS
+	Clock func() time.Time
 }
 
 // Run executes a rename for the given file. It prompts the user for CatID, FXName, CreatorID,
 // SourceID and UserData. A final confirmation is required unless forceConfirm is true.
+//
+// Symbolic links are renamed themselves unless FollowSymlinks is set, in which case the link is
+// resolved and its target is renamed instead.
 func (r Renamer) Run(filename string, forceConfirm bool) error {
-	srcFileInfo, err := os.Stat(filename)
+	if err := checkCatalog(); err != nil {
+		return err
+	}
+	p, err := r.plan(filename)
+	if err != nil {
+		return err
+	}
+	_, err = r.apply(p, forceConfirm)
+	return err
+}
+
+// PrintName prompts for the fields like Run, but writes the rendered filename to w instead of
+// renaming a file. The extension is supplied by the caller, since there's no source file; a missing
+// leading dot is added.
+func (r Renamer) PrintName(w io.Writer, ext string) error {
+	if ext != "" && !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	if r.LowerExt {
+		ext = strings.ToLower(ext)
+	}
+	if err := checkCatalog(); err != nil {
+		return err
+	}
+	f, err := r.buildFilename(promptContext{ext: ext})
 	if err != nil {
 		return err
 	}
+	_, err = fmt.Fprintln(w, r.Affix.Render(f, ext))
+	return err
+}
+
+// checkCatalog loads the categories, so that a broken category file is reported before anything is
+// prompted for rather than after. They're cached, so later lookups don't read the file again.
+func checkCatalog() error {
+	index, err := ucs.LoadIndex()
+	if err != nil {
+		return fmt.Errorf("can't load the UCS categories: %w", err)
+	}
+	if index.Len() == 0 {
+		return fmt.Errorf("can't load the UCS categories: no valid categories found")
+	}
+	return nil
+}
+
+// Rename is a single planned rename of From to To, whose name is rendered from Filename.
+type Rename struct {
+	From     string
+	To       string
+	Filename ucs.Filename
+}
+
+// plan prompts for the fields of filename and determines its new path, without renaming anything.
+func (r Renamer) plan(filename string) (Rename, error) {
+	src, ext, err := r.source(filename)
+	if err != nil {
+		return Rename{}, err
+	}
+	f, err := r.buildFilename(promptContext{ext: ext, embedded: r.embeddedFields(src)})
+	if err != nil {
+		return Rename{}, err
+	}
+	return r.newRename(src, ext, f)
+}
+
+// source resolves the path that will be renamed for filename, and the extension its new name will
+// carry.
+func (r Renamer) source(filename string) (string, string, error) {
+	if r.FollowSymlinks {
+		resolved, err := filepath.EvalSymlinks(filename)
+		if err != nil {
+			return "", "", fmt.Errorf("resolving symlink: %w", err)
+		}
+		filename = resolved
+	}
+	srcFileInfo, err := r.filesystem().Lstat(filename)
+	if err != nil {
+		return "", "", err
+	}
 	if srcFileInfo.IsDir() {
-		return fmt.Errorf("%s is a directory", srcFileInfo.Name())
+		return "", "", fmt.Errorf("%s is a directory", srcFileInfo.Name())
 	}
 	ext := filepath.Ext(srcFileInfo.Name())
+	if ext == "" && r.DefaultExt != "" {
+		ext = "." + strings.TrimPrefix(r.DefaultExt, ".")
+	}
 	if ext == "" {
-		return fmt.Errorf("no file name extension found")
+		return "", "", fmt.Errorf("no file name extension found; set UCS_DEFAULT_EXT or -ext to use a default")
+	}
+	if r.LowerExt {
+		ext = strings.ToLower(ext)
 	}
+	return filename, ext, nil
+}
 
-	f, err := r.buildFilename()
+func (r Renamer) newRename(src, ext string, f ucs.Filename) (Rename, error) {
+	dir, err := r.destDir(src)
 	if err != nil {
-		return err
+		return Rename{}, err
 	}
-	newName := f.Render(ext)
+	return Rename{
+		From:     src,
+		To:       filepath.Join(dir, r.Affix.Render(f, ext)),
+		Filename: f,
+	}, nil
+}
 
-	oldName := filepath.Base(srcFileInfo.Name())
+// destDir returns the directory src is renamed into: its own, unless OutputDir is set.
+func (r Renamer) destDir(src string) (string, error) {
+	if r.OutputDir == "" {
+		return filepath.Dir(src), nil
+	}
+	if !r.KeepStructure {
+		return r.OutputDir, nil
+	}
+	root := r.StructureRoot
+	if root == "" {
+		root = "."
+	}
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	absDir, err := filepath.Abs(filepath.Dir(src))
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(absRoot, absDir)
+	if err != nil {
+		return "", err
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside %s, so its folder structure can't be kept", src, root)
+	}
+	return filepath.Join(r.OutputDir, rel), nil
+}
+
+// apply performs a planned rename, asking for confirmation unless forceConfirm is true. It reports
+// whether the file was renamed.
+func (r Renamer) apply(p Rename, forceConfirm bool) (bool, error) {
+	warnings, err := r.renameWarnings(p.From, p.To)
+	if err != nil {
+		return false, err
+	}
+
+	var renamed bool
+	doRename := func() error {
+		if err := r.transfer(p.From, p.To); err != nil {
+			return err
+		}
+		renamed = true
+		if err := r.logRename(p); err != nil {
+			return err
+		}
+		return r.recordDatabase(p)
+	}
 	if forceConfirm {
-		return os.Rename(oldName, newName)
+		for _, w := range warnings {
+			fmt.Fprintf(r.Stderr, "Warning: %s\n", w)
+		}
+		return renamed, doRename()
 	}
 
-	return r.confirm(
-		fmt.Sprintf("Rename %q to %q?", oldName, newName),
-		func() error {
-			return os.Rename(oldName, newName)
-		},
-	)
+	prompt := fmt.Sprintf("%s %q to %q?", r.verb(), filepath.Base(p.From), filepath.Base(p.To))
+	for _, w := range warnings {
+		prompt = fmt.Sprintf("Warning: %s\n%s", w, prompt)
+	}
+	err = r.confirm(prompt, doRename)
+	return renamed, err
+}
+
+// verb names what's done to files in prompts.
+func (r Renamer) verb() string {
+	switch {
+	case r.Copy:
+		return "Copy"
+	case r.Link:
+		return "Link"
+	}
+	return "Rename"
+}
+
+// renameWarnings reports conditions worth surfacing before oldPath is renamed to newPath. An error is
+// returned instead when the rename is known to fail.
+func (r Renamer) renameWarnings(oldPath, newPath string) ([]string, error) {
+	inUse, err := fileInUse(oldPath)
+	if err != nil {
+		return nil, err
+	}
+	if inUse {
+		return nil, fmt.Errorf("%s is in use by another process", filepath.Base(oldPath))
+	}
+
+	var warnings []string
+	if w := r.encodingWarning(oldPath); w != "" {
+		warnings = append(warnings, w)
+	}
+
+	dstInfo, err := r.filesystem().Lstat(newPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return warnings, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	srcInfo, err := r.filesystem().Lstat(oldPath)
+	if err != nil {
+		return nil, err
+	}
+	if os.SameFile(srcInfo, dstInfo) {
+		return warnings, nil
+	}
+
+	newName := filepath.Base(newPath)
+	if dstInfo.Mode().Perm()&0o222 == 0 {
+		return append(warnings, fmt.Sprintf("%s already exists and is read-only; it will be overwritten", newName)), nil
+	}
+	return append(warnings, fmt.Sprintf("%s already exists; it will be overwritten", newName)), nil
 }
 
-func (r Renamer) buildFilename() (ucs.Filename, error) {
-	if catID := os.Getenv("UCS_CAT_ID"); catID != "" {
-		if err := validateCatID(catID); err != nil {
+// encodingWarning reports a source name that isn't valid UTF-8, as names from old media sometimes
+// aren't. The original bytes are lost once the file is renamed, unless the log records them.
+func (r Renamer) encodingWarning(oldPath string) string {
+	name := filepath.Base(oldPath)
+	if utf8.ValidString(name) {
+		return ""
+	}
+	if r.Log != nil {
+		return fmt.Sprintf("%q isn't valid UTF-8; its original bytes are recorded in the log", name)
+	}
+	return fmt.Sprintf("%q isn't valid UTF-8; use -rename-log to record its original bytes", name)
+}
+
+// promptContext carries what's known about a file before its fields are prompted.
+type promptContext struct {
+	// ext is the extension the rendered filename will carry.
+	ext string
+
+	// reuseFXName is offered as the FXName, and used when the answer is left empty.
+	reuseFXName string
+
+	// embedded holds the fields found in the file's metadata.
+	embedded ucs.Filename
+}
+
+func (r Renamer) buildFilename(ctx promptContext) (ucs.Filename, error) {
+	catID := r.presetOrEnv(r.Preset.CatID, "UCS_CAT_ID", ctx.ext)
+
+	var query string
+	if catID == "" && r.NoPrompt {
+		return ucs.Filename{}, fmt.Errorf("CatID is required, but was not provided and prompting is disabled")
+	}
+	if catID != "" {
+		canonical, err := resolveCatID(catID)
+		if err == nil {
+			return r.promptFields(ctx, canonical)
+		}
+		if !r.Interactive || r.NoPrompt {
 			return ucs.Filename{}, err
 		}
-		return r.promptFields(catID)
+		// Let the user correct the CatID, offering the nearest one before starting the search from
+		// what they gave us.
+		fmt.Fprintf(r.Stderr, "Invalid: %s\n", err)
+		if nearest := ucs.NearestCatIDs(catID, 1); len(nearest) > 0 {
+			ok, err := r.prompter().Confirm(fmt.Sprintf("Use %s instead?", nearest[0]))
+			if err != nil {
+				return ucs.Filename{}, err
+			}
+			if ok {
+				return r.promptFields(ctx, nearest[0])
+			}
+		}
+		query = catID
+	}
+
+	catID, err := r.prompter().Select(query)
+	if err != nil {
+		return ucs.Filename{}, err
+	}
+	canonical, err := resolveCatID(catID)
+	if err != nil {
+		return ucs.Filename{}, err
 	}
+	return r.promptFields(ctx, canonical)
+}
 
-	cmd := exec.Command(
-		r.FZFExec,
+// selectCatID asks the user to pick a CatID using fzf, with query as the initial search. The builtin
+// picker is used instead when fzf isn't available.
+func (r Renamer) selectCatID(query string) (string, error) {
+	if r.FZFExec == "" {
+		return r.pickCatID(query)
+	}
+	out, err := r.fzfSelect("Select a CatID", r.SelfCommand, query)
+	if err != nil {
+		return "", err
+	}
+	return extractCatID(out), nil
+}
+
+// fzfSelect runs fzf over the lines printed by feedCommand, with query as the initial search, and
+// returns its output. The header is shown above the list.
+func (r Renamer) fzfSelect(header, feedCommand, query string) (string, error) {
+	args := []string{
 		"--ansi",
 		"--no-preview",
-		"--header=\nSelect a CatID",
-	)
+		"--header=\n" + header,
+	}
+	if query != "" {
+		args = append(args, "--query="+query)
+	}
+	cmd := exec.Command(r.FZFExec, append(args, r.FZFOpts...)...)
 	var out bytes.Buffer
-	cmd.Stdin = r.Stdin
+	// fzf reads keystrokes from the terminal itself. Only hand it stdin when it's a file, so that
+	// input meant for the prompts that follow isn't consumed.
+	if f, ok := r.Stdin.(*os.File); ok {
+		cmd.Stdin = f
+	}
 	cmd.Stderr = r.Stderr
 	cmd.Stdout = &out
 
-	cmd.Env = append(os.Environ(), fmt.Sprintf("FZF_DEFAULT_COMMAND=%s", r.SelfCommand))
+	cmd.Env = append(os.Environ(), fmt.Sprintf("FZF_DEFAULT_COMMAND=%s", feedCommand))
 	if err := cmd.Run(); err != nil {
 		exitErr := &exec.ExitError{}
 		if errors.As(err, &exitErr) {
-			return ucs.Filename{}, err
+			return "", err
 		}
 	}
+	return out.String(), nil
+}
 
-	choice := strings.TrimSpace(out.String())
-	choiceSegs := strings.Split(choice, " ")
-	catID := strings.TrimRight(choiceSegs[0], ":")
+// parseSelection extracts the key, such as the CatID, from fzf's output. Lines are written by
+// ucs.WriteFeed or ucs.WriteUserCategoryFeed, so everything before the first ucs.FeedDelimiter of the
+// selected line is the key. fzf prints the original line regardless of --with-nth/--nth, so display
+// customizations don't affect extraction.
+func parseSelection(out string) string {
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	choice := lines[len(lines)-1]
+	catID, _, _ := strings.Cut(choice, ucs.FeedDelimiter)
+	return strings.TrimSpace(catID)
+}
 
-	return r.promptFields(catID)
+// extractCatID extracts the CatID from fzf's output like parseSelection, but checks it against the
+// categories. When the key isn't a CatID, because a custom feed or category file put something else
+// first, the first word of the selected line that is a CatID is used instead. The key is returned
+// unchanged when there's no such word, leaving it to be reported as unknown.
+func extractCatID(out string) string {
+	catID := parseSelection(out)
+	index, err := ucs.LoadIndex()
+	if err != nil {
+		return catID
+	}
+	if _, ok := index.Lookup(catID); ok {
+		return catID
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	words := strings.FieldsFunc(lines[len(lines)-1], func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, w := range words {
+		// Only a CatID itself counts; aliases are too likely to appear among the synonyms.
+		if c, ok := index.Lookup(w); ok && c.CatID == w {
+			return w
+		}
+	}
+	return catID
 }
 
-func (r Renamer) promptFields(catID string) (ucs.Filename, error) {
+// splitArgs splits s into arguments on whitespace, honoring single quotes, double quotes and
+// backslash escapes in the same way a POSIX shell would for simple words.
+func splitArgs(s string) ([]string, error) {
+	var (
+		args    []string
+		cur     strings.Builder
+		inWord  bool
+		quote   rune
+		escaped bool
+	)
+	for _, c := range s {
+		switch {
+		case escaped:
+			cur.WriteRune(c)
+			escaped = false
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+				continue
+			}
+			cur.WriteRune(c)
+		case c == '\\':
+			escaped = true
+			inWord = true
+		case quote == '"':
+			if c == '"' {
+				quote = 0
+				continue
+			}
+			cur.WriteRune(c)
+		case c == '\'' || c == '"':
+			quote = c
+			inWord = true
+		case c == ' ' || c == '\t' || c == '\n':
+			if inWord {
+				args = append(args, cur.String())
+				cur.Reset()
+				inWord = false
+			}
+		default:
+			cur.WriteRune(c)
+			inWord = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("unterminated quote or escape in %q", s)
+	}
+	if inWord {
+		args = append(args, cur.String())
+	}
+	return args, nil
+}
+
+// shellQuote quotes s as a single word for a POSIX shell, like the one fzf runs its commands with.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func (r Renamer) promptFields(ctx promptContext, catID string) (ucs.Filename, error) {
 	f := ucs.Filename{
 		CatID: catID,
 	}
@@ -116,38 +680,222 @@ func (r Renamer) promptFields(catID string) (ucs.Filename, error) {
 	fmt.Fprintf(r.Stdout, "CatID: %s\n", catID)
 
 	var err error
-	f.FXName, err = r.promptField("FXName", required, "")
+	f.UserCategory, err = r.promptUserCategory()
+	if err != nil {
+		return f, err
+	}
+	f.BracketUserCategory = r.BracketUserCategory && f.UserCategory != ""
+
+	fx := field{
+		name:     "FXName",
+		req:      required,
+		preset:   firstNonEmpty(r.Preset.FXName, ctx.embedded.FXName),
+		sanitize: r.sanitize,
+	}
+	if r.MaxLength > 0 {
+		// Account for the fields provided up front, since they're already known.
+		known := f
+		known.CreatorID, _ = r.sanitize(r.presetOrEnv(firstNonEmpty(r.Preset.CreatorID, ctx.embedded.CreatorID), "UCS_CREATOR_ID", ctx.ext))
+		known.SourceID, _ = r.sanitize(r.presetOrEnv(r.Preset.SourceID, "UCS_SOURCE_ID", ctx.ext))
+		known.UserData, _ = r.sanitize(r.presetOrEnv(r.Preset.UserData, "UCS_USER_DATA", ctx.ext))
+		if left, pending := r.fxBudget(known, ctx.ext); pending {
+			fx.label = fmt.Sprintf("FXName (at most %d characters left)", left)
+		} else {
+			fx.label = fmt.Sprintf("FXName (%d characters left)", left)
+		}
+	}
+	if ctx.reuseFXName != "" {
+		fx.req = optional
+		fx.label = fmt.Sprintf("%s [%s]", fx.labelOrName(), ctx.reuseFXName)
+	}
+
+	f.FXName, err = r.promptField(fx)
 	if err != nil {
 		return f, err
 	}
+	if f.FXName == "" {
+		f.FXName = ctx.reuseFXName
+	}
 	if f.FXName == "" {
 		return f, fmt.Errorf("FXName is required")
 	}
+	if f.FXName, err = r.filterFXName(f.FXName); err != nil {
+		return f, err
+	}
 
-	f.CreatorID, err = r.promptField("CreatorID", required, "UCS_CREATOR_ID")
+	f.CreatorID, err = r.promptField(field{
+		name:     "CreatorID",
+		req:      r.requirement("CreatorID"),
+		preset:   firstNonEmpty(r.Preset.CreatorID, ctx.embedded.CreatorID),
+		envVar:   "UCS_CREATOR_ID",
+		ext:      ctx.ext,
+		sanitize: r.sanitize,
+	})
 	if err != nil {
 		return f, err
 	}
-	if f.CreatorID == "" {
+	if f.CreatorID == "" && r.requirement("CreatorID") == required {
 		return f, fmt.Errorf("CreatorID is required")
 	}
 
-	f.SourceID, err = r.promptField("SourceID", required, "UCS_SOURCE_ID")
+	f.SourceID, err = r.promptField(field{
+		name:     "SourceID",
+		req:      r.requirement("SourceID"),
+		preset:   r.Preset.SourceID,
+		envVar:   "UCS_SOURCE_ID",
+		ext:      ctx.ext,
+		sanitize: r.sanitize,
+	})
 	if err != nil {
 		return f, err
 	}
-	if f.SourceID == "" {
+	if f.SourceID == "" && r.requirement("SourceID") == required {
 		return f, fmt.Errorf("SourceID is required")
 	}
 
-	f.UserData, err = r.promptField("UserData", optional, "UCS_USER_DATA")
+	userData := field{
+		name:     "UserData",
+		req:      r.requirement("UserData"),
+		preset:   r.Preset.UserData,
+		envVar:   "UCS_USER_DATA",
+		ext:      ctx.ext,
+		sanitize: r.sanitize,
+	}
+	if r.UserDataTokens {
+		userData.label = "UserData (comma-separated)"
+		userData.sanitize = r.sanitizeTokens
+	}
+	f.UserData, err = r.promptField(userData)
 	if err != nil {
 		return f, err
 	}
+	if trimmed, ok := trimSegment(f.UserData, r.TrimUserData); ok {
+		fmt.Fprintf(r.Stderr, "Warning: UserData trimmed from %q to %q\n", f.UserData, trimmed)
+		f.UserData = trimmed
+	}
 
+	if r.MaxLength > 0 && Budget(f, ctx.ext, r.maxUCSLength()) < 0 {
+		name := r.Affix.Render(f, ctx.ext)
+		return f, fmt.Errorf("%s is %d characters, exceeding the limit of %d", name, len(name), r.MaxLength)
+	}
 	return f, nil
 }
 
+// filterFXName runs fxName through FXNameFilter, when it's set. A filter that fails aborts the rename,
+// with what it wrote to stderr.
+func (r Renamer) filterFXName(fxName string) (string, error) {
+	if r.FXNameFilter == "" {
+		return fxName, nil
+	}
+	args, err := splitArgs(r.FXNameFilter)
+	if err != nil {
+		return "", fmt.Errorf("FXName filter: %w", err)
+	}
+	if len(args) == 0 {
+		return fxName, nil
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = strings.NewReader(fxName + "\n")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("FXName filter: %w: %s", err, msg)
+		}
+		return "", fmt.Errorf("FXName filter: %w", err)
+	}
+	filtered, err := r.sanitize(stdout.String())
+	if err != nil {
+		return "", fmt.Errorf("FXName filter output: %w", err)
+	}
+	if filtered == "" {
+		return "", fmt.Errorf("FXName filter output is empty")
+	}
+	return filtered, nil
+}
+
+// promptUserCategory returns the UserCategory, selected with fzf when it's available. It's always
+// empty when there are no UserCategories.
+func (r Renamer) promptUserCategory() (string, error) {
+	if len(r.UserCategories) == 0 {
+		return "", nil
+	}
+	fd := field{
+		name:     "UserCategory",
+		req:      optional,
+		preset:   r.Preset.UserCategory,
+		envVar:   "UCS_USER_CATEGORY",
+		sanitize: r.checkUserCategory,
+	}
+	if fd.preset == "" && os.Getenv(fd.envVar) == "" && !r.NoPrompt && r.Responses == nil && r.FZFExec != "" {
+		out, err := r.fzfSelect("Select a UserCategory (Esc for none)", r.UserCategoryCommand, "")
+		exitErr := &exec.ExitError{}
+		if errors.As(err, &exitErr) {
+			// Leaving fzf without a selection leaves the field empty.
+			return "", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if fd.preset = parseSelection(out); fd.preset == "" {
+			return "", nil
+		}
+	}
+	return r.promptField(fd)
+}
+
+// checkUserCategory accepts an empty value or the name of one of the UserCategories, matched
+// case-insensitively and returned as it's spelled in the taxonomy.
+func (r Renamer) checkUserCategory(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "", nil
+	}
+	for _, uc := range r.UserCategories {
+		if strings.EqualFold(uc.Name, s) {
+			return uc.Name, nil
+		}
+	}
+	return "", fmt.Errorf("unknown UserCategory %q", s)
+}
+
+// Budget returns how many more characters the FXName of f can grow by before its rendered filename,
+// with the given extension, exceeds max. Lengths are measured in bytes, as filesystems limit them.
+// Fields of f that are still empty count only for the delimiters ucs.Filename.Render keeps.
+// The result is negative when the filename already exceeds max.
+func Budget(f ucs.Filename, ext string, max int) int {
+	return max - len(f.Render(ext))
+}
+
+// fxBudget returns the budget shown at the FXName prompt, given the fields known before FXName is
+// entered. Required fields that are still to be entered count for their delimiters alone, since
+// their lengths aren't known yet; the boolean reports whether there are any, in which case the
+// budget is an upper bound.
+func (r Renamer) fxBudget(known ucs.Filename, ext string) (int, bool) {
+	pending := 0
+	for _, s := range []struct {
+		name  string
+		value *string
+	}{
+		{"CreatorID", &known.CreatorID},
+		{"SourceID", &known.SourceID},
+		{"UserData", &known.UserData},
+	} {
+		if *s.value == "" && r.requirement(s.name) == required {
+			// A single-character stand-in makes Render keep the delimiter, and is discounted below.
+			*s.value = "x"
+			pending++
+		}
+	}
+	return Budget(known, ext, r.maxUCSLength()) + pending, pending > 0
+}
+
+// maxUCSLength is the part of MaxLength left for the UCS name once the affix is accounted for.
+func (r Renamer) maxUCSLength() int {
+	return r.MaxLength - len(r.Affix.Prefix) - len(r.Affix.Suffix)
+}
+
 type requirement int
 
 const (
@@ -155,60 +903,258 @@ const (
 	optional
 )
 
-func (r Renamer) promptField(fieldName string, req requirement, envOverrideVar string) (string, error) {
-	if envOverrideVar != "" {
-		val := os.Getenv(envOverrideVar)
-		if val != "" {
-			return val, nil
+// requirement reports whether the named field is required, according to Required.
+func (r Renamer) requirement(name string) requirement {
+	if slices.Contains(r.requiredFields(), name) {
+		return required
+	}
+	return optional
+}
+
+// requiredFields returns Required, or ucs.DefaultRequired when it's empty.
+func (r Renamer) requiredFields() []string {
+	if len(r.Required) == 0 {
+		return ucs.DefaultRequired
+	}
+	return r.Required
+}
+
+// field describes a single field to prompt for.
+type field struct {
+	name     string
+	label    string // shown at the prompt in place of name, when set
+	req      requirement
+	preset   string // provided by a flag
+	envVar   string // consulted when there's no preset
+	ext      string // selects the per-extension default consulted after envVar
+	sanitize func(string) (string, error)
+}
+
+func (fd field) labelOrName() string {
+	if fd.label != "" {
+		return fd.label
+	}
+	return fd.name
+}
+
+// promptField returns the value of a field. The preset value takes precedence, followed by the
+// environment. The user is prompted when neither is provided, unless NoPrompt is set, in which case
+// required fields are an error and optional fields are left empty.
+func (r Renamer) promptField(fd field) (string, error) {
+	if fd.preset != "" {
+		return fd.sanitize(fd.preset)
+	}
+	if fd.envVar != "" {
+		// Environment values are sanitized like typed ones. One that's only whitespace counts as
+		// unset, unless the field is optional.
+		if val, name := lookupEnv(fd.envVar, fd.ext); val != "" {
+			sanitized, err := fd.sanitize(val)
+			if err != nil {
+				return "", fmt.Errorf("%s: %w", name, err)
+			}
+			if sanitized != "" || fd.req == optional {
+				return sanitized, nil
+			}
+		}
+	}
+	if r.NoPrompt {
+		if fd.req == required {
+			return "", fmt.Errorf("%s is required, but was not provided and prompting is disabled", fd.name)
 		}
+		return "", nil
 	}
 
+	if r.Responses != nil {
+		return r.readResponse(fd)
+	}
 	for {
-		fmt.Fprintf(r.Stdout, "%s: ", fieldName)
-		reader := bufio.NewReader(r.Stdin)
-		text, err := reader.ReadString('\n')
+		text, err := r.prompter().Input(fd.labelOrName())
 		if err != nil {
 			return "", err
 		}
 		trimmed := strings.TrimSpace(text)
-		if req == required && trimmed == "" {
-			fmt.Fprintf(r.Stderr, "Invalid: %s is required\n", fieldName)
+		if fd.req == required && trimmed == "" {
+			fmt.Fprintf(r.Stderr, "Invalid: %s is required\n", fd.name)
 			continue
 		}
-		if strings.Contains(trimmed, "_") {
-			fmt.Fprintln(r.Stderr, "Invalid: value cannot contain \"_\", because it is the filename field delimiter")
+		sanitized, err := fd.sanitize(trimmed)
+		if err != nil {
+			fmt.Fprintf(r.Stderr, "Invalid: %s\n", err)
 			continue
 		}
-		return strings.Join(strings.Fields(trimmed), "-"), nil
+		return sanitized, nil
 	}
 }
 
-func (r Renamer) confirm(prompt string, yes func() error) error {
+// readResponse answers a prompt with the next line of Responses. Unlike an answer typed by the user,
+// an invalid response is an error rather than being asked again.
+func (r Renamer) readResponse(fd field) (string, error) {
+	fmt.Fprintf(r.Stdout, "%s: ", fd.labelOrName())
+	text, err := readLine(r.Responses)
+	if err == io.EOF {
+		return "", fmt.Errorf("%s: no answer left in the responses", fd.name)
+	}
+	if err != nil {
+		return "", err
+	}
+	trimmed := strings.TrimSpace(text)
+	fmt.Fprintln(r.Stdout, trimmed)
+	if fd.req == required && trimmed == "" {
+		return "", fmt.Errorf("%s is required", fd.name)
+	}
+	sanitized, err := fd.sanitize(trimmed)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", fd.name, err)
+	}
+	return sanitized, nil
+}
+
+// sanitize prepares a field value for use as a filename segment, replacing whitespace with SpaceChar.
+func (r Renamer) sanitize(s string) (string, error) {
+	space := r.SpaceChar
+	if space == "" && !r.RemoveSpaces {
+		space = "-"
+	}
+	return ucs.SanitizeSegmentWith(s, space)
+}
+
+// presetOrEnv returns preset if it's set, and the value of the environment variable, or its default
+// for files with extension ext, otherwise.
+func (r Renamer) presetOrEnv(preset, envVar, ext string) string {
+	if preset != "" {
+		return preset
+	}
+	val, _ := lookupEnv(envVar, ext)
+	return val
+}
+
+// lookupEnv returns the value of envVar, along with the name of the variable it came from. When
+// envVar is empty, the default for files with extension ext is used: envVar with UCS_EXT_<EXT>_ in
+// place of its UCS_ prefix, such as UCS_EXT_FLAC_SOURCE_ID for UCS_SOURCE_ID and .flac files.
+func lookupEnv(envVar, ext string) (string, string) {
+	if val := os.Getenv(envVar); val != "" || ext == "" {
+		return val, envVar
+	}
+	name := extEnvVar(envVar, ext)
+	return os.Getenv(name), name
+}
+
+// extEnvVar names the per-extension default of envVar.
+func extEnvVar(envVar, ext string) string {
+	ext = strings.ToUpper(strings.TrimPrefix(ext, "."))
+	return "UCS_EXT_" + ext + "_" + strings.TrimPrefix(envVar, "UCS_")
+}
+
+// sanitizeTokens sanitizes a comma-separated list of tokens individually and joins them with dashes,
+// so "close, wet, take2" becomes "close-wet-take2". Empty tokens are dropped.
+func (r Renamer) sanitizeTokens(s string) (string, error) {
+	var tokens []string
+	for _, t := range strings.Split(s, ",") {
+		sanitized, err := r.sanitize(t)
+		if err != nil {
+			return "", fmt.Errorf("token %q: %w", strings.TrimSpace(t), err)
+		}
+		if sanitized != "" {
+			tokens = append(tokens, sanitized)
+		}
+	}
+	return strings.Join(tokens, "-"), nil
+}
+
+// trimSegment truncates s to at most n characters, reporting whether it was truncated. The cut is
+// made at the last dash that fits, so words are kept whole, unless the first word alone is too long.
+// Characters are runes, so a multibyte character is never split, and no trailing dash is left.
+func trimSegment(s string, n int) (string, bool) {
+	runes := []rune(s)
+	if n <= 0 || len(runes) <= n {
+		return s, false
+	}
+	cut := runes[:n]
+	if runes[n] != '-' {
+		for i := len(cut) - 1; i > 0; i-- {
+			if cut[i] == '-' {
+				cut = cut[:i]
+				break
+			}
+		}
+	}
+	return strings.TrimRight(string(cut), "-"), true
+}
+
+// readLine reads a single line from r. Input is read a byte at a time so nothing past the newline is
+// consumed, leaving it for subsequent prompts.
+func readLine(r io.Reader) (string, error) {
+	var (
+		line []byte
+		b    [1]byte
+	)
 	for {
-		var confirm string
-		fmt.Printf("%s (y/n) ", prompt)
-		fmt.Fscanf(r.Stdin, "%s", &confirm)
-		switch strings.ToLower(confirm) {
-		case "y", "yes":
-			return yes()
-		case "n", "no":
-			return nil
-		default:
-			return nil
+		n, err := r.Read(b[:])
+		if n > 0 {
+			if b[0] == '\n' {
+				return string(line), nil
+			}
+			line = append(line, b[0])
+		}
+		if err == io.EOF && len(line) > 0 {
+			return string(line), nil
+		}
+		if err != nil {
+			return "", err
 		}
 	}
 }
 
-func validateCatID(catID string) error {
-	categories, err := ucs.Categories()
-	if err != nil {
+// confirm asks a yes/no question with the Prompter, calling yes if the answer is affirmative.
+func (r Renamer) confirm(prompt string, yes func() error) error {
+	ok, err := r.prompter().Confirm(prompt)
+	if err != nil || !ok {
 		return err
 	}
-	exists := slices.ContainsFunc(categories, func(c ucs.Category) bool {
-		return c.CatID == catID
-	})
-	if !exists {
-		return fmt.Errorf("unknown CatID: %s", catID)
+	return yes()
+}
+
+// resolveCatID validates catID, which may be an alias or differ in case from the catalog, and returns
+// the canonical CatID. Its format is checked before whether it exists, so a malformed CatID is
+// reported as such, but aliases and CatIDs typed in another case resolve without being shaped like
+// one.
+func resolveCatID(catID string) (string, error) {
+	if !ucs.ValidCatIDFormat(catID) {
+		if canonical, ok, err := knownCatID(catID); err != nil || ok {
+			return canonical, err
+		}
+		return "", fmt.Errorf("malformed CatID %q: expected an uppercase CatShort followed by letters and digits (e.g. AMBPark)", catID)
 	}
-	return nil
+	canonical, ok, err := knownCatID(catID)
+	if err != nil || ok {
+		return canonical, err
+	}
+
+	err = fmt.Errorf("unknown CatID: %s", catID)
+	if nearest := ucs.NearestCatIDs(catID, maxSuggestions); len(nearest) > 0 {
+		suggestion := nearest[len(nearest)-1]
+		if len(nearest) > 1 {
+			suggestion = strings.Join(nearest[:len(nearest)-1], ", ") + " or " + suggestion
+		}
+		return "", fmt.Errorf("%w; did you mean %s?", err, suggestion)
+	}
+	return "", err
 }
+
+// knownCatID returns the canonical CatID that catID names, matching it case-insensitively against
+// the catalog's CatIDs and then against its aliases. The boolean reports whether it names one.
+func knownCatID(catID string) (string, bool, error) {
+	canonical, ok, err := ucs.CanonicalCatID(catID)
+	if err != nil || ok {
+		return canonical, ok, err
+	}
+	idx, err := ucs.LoadIndex()
+	if err != nil {
+		return "", false, err
+	}
+	c, ok := idx.Lookup(catID)
+	return c.CatID, ok, nil
+}
+
+// maxSuggestions is the number of CatIDs suggested in place of an unknown one.
+const maxSuggestions = 3
@@ -0,0 +1,536 @@
+package renamer
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/brettbuddin/ucsrename/ucs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitArgs(t *testing.T) {
+	args, err := splitArgs(`--height=40% --bind 'ctrl-a:select-all' --header="Pick one"  --reverse`)
+	require.NoError(t, err)
+	require.Equal(t, []string{"--height=40%", "--bind", "ctrl-a:select-all", "--header=Pick one", "--reverse"}, args)
+
+	args, err = splitArgs("")
+	require.NoError(t, err)
+	require.Empty(t, args)
+
+	_, err = splitArgs(`--header="unterminated`)
+	require.Error(t, err)
+}
+
+func TestShellQuote(t *testing.T) {
+	for _, s := range []string{"/usr/local/bin/ucsrename", "/Users/me/My Tools/ucsrename", "it's", ""} {
+		args, err := splitArgs(shellQuote(s) + " -list-categories")
+		require.NoError(t, err)
+		require.Equal(t, []string{s, "-list-categories"}, args)
+	}
+}
+
+func TestParseSelection(t *testing.T) {
+	require.Equal(t, "AMBPark", parseSelection("AMBPark: AMBIENCE PARK -- park, playground\n"))
+	require.Equal(t, "AMBPark", parseSelection("park\nAMBPark: AMBIENCE PARK -- park, playground\n"), "last line is the selection")
+	require.Equal(t, "", parseSelection(""))
+}
+
+func TestExtractCatID(t *testing.T) {
+	for _, tt := range []struct {
+		line string
+		want string
+	}{
+		{"AMBPark: AMBIENCE PARK -- park, playground", "AMBPark"},
+		{"  42  AMBPark: AMBIENCE PARK -- park", "AMBPark"},
+		{"AMBIENCE PARK AMBPark -- park", "AMBPark"},
+		{"[AMBPark] AMBIENCE PARK", "AMBPark"},
+		{"AMBIENCE: PARK (AMBPark) -- park", "AMBPark"},
+		{"AMBIENCE PARK -- park", "AMBIENCE PARK -- park"},
+		{"whoosh: AIR BLOW", "whoosh"},
+		{"", ""},
+	} {
+		require.Equal(t, tt.want, extractCatID(tt.line), tt.line)
+	}
+}
+
+func TestRenameWarnings(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.wav")
+	dst := filepath.Join(dir, "dst.wav")
+	require.NoError(t, os.WriteFile(src, nil, 0o644))
+
+	warnings, err := Renamer{}.renameWarnings(src, dst)
+	require.NoError(t, err)
+	require.Empty(t, warnings, "destination doesn't exist")
+
+	warnings, err = Renamer{}.renameWarnings(src, src)
+	require.NoError(t, err)
+	require.Empty(t, warnings, "renaming to itself")
+
+	require.NoError(t, os.WriteFile(dst, nil, 0o644))
+	warnings, err = Renamer{}.renameWarnings(src, dst)
+	require.NoError(t, err)
+	require.Equal(t, []string{"dst.wav already exists; it will be overwritten"}, warnings)
+
+	require.NoError(t, os.Chmod(dst, 0o444))
+	warnings, err = Renamer{}.renameWarnings(src, dst)
+	require.NoError(t, err)
+	require.Equal(t, []string{"dst.wav already exists and is read-only; it will be overwritten"}, warnings)
+}
+
+func TestSanitizeTokens(t *testing.T) {
+	s, err := Renamer{}.sanitizeTokens("close, wet, take2")
+	require.NoError(t, err)
+	require.Equal(t, "close-wet-take2", s)
+
+	s, err = Renamer{}.sanitizeTokens("very close,, wet ")
+	require.NoError(t, err)
+	require.Equal(t, "very-close-wet", s, "empty tokens are dropped")
+
+	_, err = Renamer{}.sanitizeTokens("close, wet_dry")
+	require.ErrorContains(t, err, `token "wet_dry"`)
+
+	s, err = Renamer{RemoveSpaces: true}.sanitizeTokens("very close, wet")
+	require.NoError(t, err)
+	require.Equal(t, "veryclose-wet", s, "tokens are still joined with dashes")
+}
+
+// testRenamer returns a Renamer that reads prompt answers from stdin. CatID, CreatorID and SourceID
+// are provided through the environment, so only FXName and UserData are prompted.
+func testRenamer(t *testing.T, stdin string) Renamer {
+	t.Setenv("UCS_CAT_ID", "AMBPark")
+	t.Setenv("UCS_CREATOR_ID", "Buddin")
+	t.Setenv("UCS_SOURCE_ID", "Phonogrifter")
+	t.Setenv("UCS_USER_DATA", "")
+	return Renamer{
+		Stdin:  strings.NewReader(stdin),
+		Stdout: &bytes.Buffer{},
+		Stderr: &bytes.Buffer{},
+	}
+}
+
+func TestRunSymlink(t *testing.T) {
+	const renamed = "AMBPark_Fountain_Buddin_Phonogrifter.wav"
+
+	t.Run("link is renamed", func(t *testing.T) {
+		dir := t.TempDir()
+		target := filepath.Join(dir, "target.wav")
+		link := filepath.Join(dir, "link.wav")
+		require.NoError(t, os.WriteFile(target, nil, 0o644))
+		require.NoError(t, os.Symlink(target, link))
+
+		r := testRenamer(t, "Fountain\n\n")
+		require.NoError(t, r.Run(link, true))
+
+		dest, err := os.Readlink(filepath.Join(dir, renamed))
+		require.NoError(t, err, "renamed file is still a link")
+		require.Equal(t, target, dest)
+		require.FileExists(t, target)
+	})
+
+	t.Run("target is renamed", func(t *testing.T) {
+		dir := t.TempDir()
+		target := filepath.Join(dir, "target.wav")
+		link := filepath.Join(dir, "link.wav")
+		require.NoError(t, os.WriteFile(target, nil, 0o644))
+		require.NoError(t, os.Symlink(target, link))
+
+		r := testRenamer(t, "Fountain\n\n")
+		r.FollowSymlinks = true
+		require.NoError(t, r.Run(link, true))
+
+		info, err := os.Lstat(filepath.Join(dir, renamed))
+		require.NoError(t, err)
+		require.True(t, info.Mode().IsRegular(), "target was renamed")
+		require.NoFileExists(t, target)
+	})
+
+	t.Run("dangling link is renamed", func(t *testing.T) {
+		dir := t.TempDir()
+		link := filepath.Join(dir, "link.wav")
+		require.NoError(t, os.Symlink(filepath.Join(dir, "missing.wav"), link))
+
+		r := testRenamer(t, "Fountain\n\n")
+		require.NoError(t, r.Run(link, true))
+
+		_, err := os.Readlink(filepath.Join(dir, renamed))
+		require.NoError(t, err)
+	})
+
+	t.Run("dangling link cannot be followed", func(t *testing.T) {
+		dir := t.TempDir()
+		link := filepath.Join(dir, "link.wav")
+		require.NoError(t, os.Symlink(filepath.Join(dir, "missing.wav"), link))
+
+		r := testRenamer(t, "Fountain\n\n")
+		r.FollowSymlinks = true
+		require.ErrorContains(t, r.Run(link, true), "resolving symlink")
+	})
+}
+
+func TestConfirm(t *testing.T) {
+	var called bool
+	yes := func() error {
+		called = true
+		return nil
+	}
+
+	r := testRenamer(t, "maybe\nyes\n")
+	require.NoError(t, r.confirm("Rename?", yes))
+	require.True(t, called, "invalid answers repeat the question")
+	require.Contains(t, r.Stderr.(*bytes.Buffer).String(), "Invalid")
+	require.Equal(t, "Rename? (y/N) Rename? (y/N) ", r.Stdout.(*bytes.Buffer).String())
+
+	called = false
+	r = testRenamer(t, "\n")
+	require.NoError(t, r.confirm("Rename?", yes))
+	require.False(t, called, "defaults to no")
+
+	r = testRenamer(t, "\n")
+	r.DefaultYes = true
+	require.NoError(t, r.confirm("Rename?", yes))
+	require.True(t, called, "defaults to yes")
+	require.Equal(t, "Rename? (Y/n) ", r.Stdout.(*bytes.Buffer).String())
+}
+
+func TestPrintName(t *testing.T) {
+	r := testRenamer(t, "Fountain\n\n")
+	var out bytes.Buffer
+	require.NoError(t, r.PrintName(&out, "wav"))
+	require.Equal(t, "AMBPark_Fountain_Buddin_Phonogrifter.wav\n", out.String())
+}
+
+func TestResolveCatID(t *testing.T) {
+	catID, err := resolveCatID("AMBPark")
+	require.NoError(t, err)
+	require.Equal(t, "AMBPark", catID)
+
+	catID, err = resolveCatID("ambpark")
+	require.NoError(t, err)
+	require.Equal(t, "AMBPark", catID, "casing is normalized against the catalog")
+
+	// A malformed CatID is reported as such, before its existence is checked.
+	for _, catID := range []string{"amb park", "AMB_Park", "A", "9AMBPark"} {
+		_, err = resolveCatID(catID)
+		require.ErrorContains(t, err, "malformed CatID", catID)
+		require.NotContains(t, err.Error(), "unknown CatID", catID)
+	}
+
+	_, err = resolveCatID("AMBNope")
+	require.ErrorContains(t, err, "unknown CatID")
+
+	t.Setenv("UCS_CSV_FILE", filepath.Join("..", "ucs", "testdata", "aliases.csv"))
+	catID, err = resolveCatID("whoosh")
+	require.NoError(t, err)
+	require.Equal(t, "AIRBlow", catID, "aliases resolve to the canonical CatID")
+}
+
+// fakeFZF writes an executable that stands in for fzf. It records its arguments to the returned path
+// and selects the given line.
+func fakeFZF(t *testing.T, selection string) (string, string) {
+	dir := t.TempDir()
+	argsPath := filepath.Join(dir, "args")
+	exec := filepath.Join(dir, "fzf")
+	script := "#!/bin/sh\necho \"$@\" > " + argsPath + "\necho '" + selection + "'\n"
+	require.NoError(t, os.WriteFile(exec, []byte(script), 0o755))
+	return exec, argsPath
+}
+
+func TestBuildFilenameCorrectsCatID(t *testing.T) {
+	r := testRenamer(t, "Fountain\n\n")
+	r.Preset.CatID = "AMBPrak"
+	_, err := r.buildFilename(promptContext{})
+	require.EqualError(t, err, "unknown CatID: AMBPrak; did you mean AMBPark?", "non-interactive is an error")
+
+	// The nearest CatID is offered first.
+	r = testRenamer(t, "y\nFountain\n\n")
+	r.Preset.CatID = "AMBPrak"
+	r.Interactive = true
+	f, err := r.buildFilename(promptContext{})
+	require.NoError(t, err)
+	require.Equal(t, "AMBPark", f.CatID)
+
+	// Declining it falls back to searching from what was given.
+	r = testRenamer(t, "n\nFountain\n\n")
+	r.Preset.CatID = "AMBPrak"
+	r.Interactive = true
+	var argsPath string
+	r.FZFExec, argsPath = fakeFZF(t, "AMBPark: AMBIENCE PARK -- park")
+	f, err = r.buildFilename(promptContext{})
+	require.NoError(t, err)
+	require.Equal(t, "AMBPark", f.CatID)
+
+	args, err := os.ReadFile(argsPath)
+	require.NoError(t, err)
+	require.Contains(t, string(args), "--query=AMBPrak")
+}
+
+func TestBudget(t *testing.T) {
+	f := ucs.Filename{CatID: "AMBPark", CreatorID: "Buddin", SourceID: "Phonogrifter"}
+	// AMBPark__Buddin_Phonogrifter.wav
+	require.Equal(t, 40-32, Budget(f, ".wav", 40))
+
+	f.FXName = "Fountain"
+	require.Equal(t, 0, Budget(f, ".wav", 40))
+
+	f.UserData = "Close"
+	require.Equal(t, -6, Budget(f, ".wav", 40))
+}
+
+func TestMaxLength(t *testing.T) {
+	r := testRenamer(t, "Central Park Fountain\n\n")
+	r.MaxLength = 40
+	_, err := r.buildFilename(promptContext{ext: ".wav"})
+	require.ErrorContains(t, err, "exceeding the limit of 40")
+	require.Contains(t, r.Stdout.(*bytes.Buffer).String(), "FXName (8 characters left): ")
+
+	// SourceID is still to be entered, so only its delimiter is counted: AMBPark__Buddin_.wav
+	r = testRenamer(t, "Fountain\nPhono\n\n")
+	t.Setenv("UCS_SOURCE_ID", "")
+	r.MaxLength = 40
+	f, err := r.buildFilename(promptContext{ext: ".wav"})
+	require.NoError(t, err)
+	require.Contains(t, r.Stdout.(*bytes.Buffer).String(), "FXName (at most 20 characters left): ")
+	require.Equal(t, "AMBPark_Fountain_Buddin_Phono.wav", f.Render(".wav"))
+}
+
+func TestNoPrompt(t *testing.T) {
+	r := testRenamer(t, "")
+	r.NoPrompt = true
+	r.Preset = ucs.Filename{FXName: "Central Park", CreatorID: "BuddinFX"}
+	f, err := r.buildFilename(promptContext{})
+	require.NoError(t, err)
+	require.Equal(t, ucs.Filename{
+		CatID:     "AMBPark",
+		FXName:    "Central-Park",
+		CreatorID: "BuddinFX",
+		SourceID:  "Phonogrifter",
+	}, f, "flags take precedence over the environment")
+
+	r.Preset = ucs.Filename{}
+	_, err = r.buildFilename(promptContext{})
+	require.ErrorContains(t, err, "FXName is required, but was not provided")
+
+	t.Setenv("UCS_CAT_ID", "")
+	_, err = r.buildFilename(promptContext{})
+	require.ErrorContains(t, err, "CatID is required, but was not provided")
+}
+
+// recordingFS records the renames made through it, without performing them.
+type recordingFS struct {
+	osFS
+	renames [][2]string
+}
+
+func (fs *recordingFS) Rename(oldpath, newpath string) error {
+	fs.renames = append(fs.renames, [2]string{oldpath, newpath})
+	return nil
+}
+
+func TestRunUsesFS(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "foo.wav")
+	require.NoError(t, os.WriteFile(src, nil, 0o644))
+
+	fs := &recordingFS{}
+	r := testRenamer(t, "Fountain\n\n")
+	r.FS = fs
+	require.NoError(t, r.Run(src, true))
+	require.Equal(t, [][2]string{{src, filepath.Join(dir, "AMBPark_Fountain_Buddin_Phonogrifter.wav")}}, fs.renames)
+	require.FileExists(t, src, "nothing was renamed on disk")
+}
+
+func TestClock(t *testing.T) {
+	fixed := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	require.Equal(t, fixed, Renamer{Clock: func() time.Time { return fixed }}.now())
+	require.WithinDuration(t, time.Now(), Renamer{}.now(), time.Minute)
+}
+
+func TestResponses(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "foo.wav")
+	require.NoError(t, os.WriteFile(src, nil, 0o644))
+
+	r := testRenamer(t, "")
+	t.Setenv("UCS_CREATOR_ID", "")
+	t.Setenv("UCS_SOURCE_ID", "")
+	r.Responses = strings.NewReader("Fountain\nBuddin\nPhonogrifter\n\n")
+	require.NoError(t, r.Run(src, true))
+	require.FileExists(t, filepath.Join(dir, "AMBPark_Fountain_Buddin_Phonogrifter.wav"))
+
+	r.Responses = strings.NewReader("Fountain\nBuddin\n")
+	_, err := r.buildFilename(promptContext{ext: ".wav"})
+	require.ErrorContains(t, err, "SourceID: no answer left")
+
+	r.Responses = strings.NewReader("Foun_tain\n")
+	_, err = r.buildFilename(promptContext{ext: ".wav"})
+	require.ErrorIs(t, err, ucs.ErrDelimiter)
+}
+
+func TestEnvSanitized(t *testing.T) {
+	r := testRenamer(t, "Fountain\n")
+	t.Setenv("UCS_USER_DATA", "   ")
+	t.Setenv("UCS_SOURCE_ID", " Phono  grifter ")
+	f, err := r.buildFilename(promptContext{ext: ".wav"})
+	require.NoError(t, err)
+	require.Equal(t, "AMBPark_Fountain_Buddin_Phono-grifter.wav", f.Render(".wav"))
+}
+
+func TestEnvUnderscore(t *testing.T) {
+	r := testRenamer(t, "Fountain\n")
+	t.Setenv("UCS_CREATOR_ID", "Studio_One")
+	_, err := r.buildFilename(promptContext{ext: ".wav"})
+	require.ErrorIs(t, err, ucs.ErrDelimiter)
+	require.ErrorContains(t, err, "UCS_CREATOR_ID")
+}
+
+func TestRunAffix(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "foo.wav")
+	require.NoError(t, os.WriteFile(src, nil, 0o644))
+
+	r := testRenamer(t, "Fountain\n\n")
+	r.Affix = ucs.Affix{Prefix: "PROJ-", Suffix: "-v2"}
+	require.NoError(t, r.Run(src, true))
+	require.FileExists(t, filepath.Join(dir, "PROJ-AMBPark_Fountain_Buddin_Phonogrifter-v2.wav"))
+}
+
+func TestUserCategory(t *testing.T) {
+	r := testRenamer(t, "Fountain\n\n")
+	r.UserCategories = []ucs.UserCategory{{Name: "Dusk"}, {Name: "Night"}}
+	r.FZFExec, _ = fakeFZF(t, "Night: Late ambiences")
+	f, err := r.buildFilename(promptContext{})
+	require.NoError(t, err)
+	require.Equal(t, "Night", f.UserCategory)
+
+	r = testRenamer(t, "Fountain\n\n")
+	r.UserCategories = []ucs.UserCategory{{Name: "Dusk"}}
+	t.Setenv("UCS_USER_CATEGORY", "dusk")
+	f, err = r.buildFilename(promptContext{})
+	require.NoError(t, err)
+	require.Equal(t, "Dusk", f.UserCategory, "spelled as in the taxonomy")
+
+	t.Setenv("UCS_USER_CATEGORY", "Dawn")
+	_, err = r.buildFilename(promptContext{})
+	require.ErrorContains(t, err, `unknown UserCategory "Dawn"`)
+
+	r = testRenamer(t, "Fountain\n\n")
+	f, err = r.buildFilename(promptContext{})
+	require.NoError(t, err)
+	require.Empty(t, f.UserCategory, "not prompted without a taxonomy")
+}
+
+func TestRunBrokenCatalog(t *testing.T) {
+	dir := t.TempDir()
+	csvPath := filepath.Join(dir, "broken.csv")
+	require.NoError(t, os.WriteFile(csvPath, []byte("AMBIENCE,PARK,AMB\"Park\n"), 0o644))
+	path := filepath.Join(dir, "fountain.wav")
+	require.NoError(t, os.WriteFile(path, nil, 0o644))
+
+	r := testRenamer(t, "Fountain\n\n")
+	t.Setenv("UCS_CSV_FILE", csvPath)
+	err := r.Run(path, true)
+	require.ErrorContains(t, err, "can't load the UCS categories: "+csvPath)
+	require.Empty(t, r.Stdout.(*bytes.Buffer).String(), "nothing is prompted for")
+	require.FileExists(t, path)
+}
+
+func TestFXNameFilter(t *testing.T) {
+	r := testRenamer(t, "Central park fountain\n\n")
+	r.FXNameFilter = "tr a-z A-Z"
+	f, err := r.buildFilename(promptContext{})
+	require.NoError(t, err)
+	require.Equal(t, "CENTRAL-PARK-FOUNTAIN", f.FXName)
+
+	r = testRenamer(t, "Fountain\n\n")
+	r.FXNameFilter = `sh -c 'echo "not in the style guide" >&2; exit 3'`
+	_, err = r.buildFilename(promptContext{})
+	require.ErrorContains(t, err, "FXName filter: exit status 3: not in the style guide")
+}
+
+func TestRequiredFields(t *testing.T) {
+	r := testRenamer(t, "Fountain\n\n\n")
+	t.Setenv("UCS_SOURCE_ID", "")
+	r.Required = []string{"CatID", "FXName", "CreatorID"}
+	f, err := r.buildFilename(promptContext{ext: ".wav"})
+	require.NoError(t, err)
+	require.Equal(t, "AMBPark_Fountain_Buddin.wav", f.Render(".wav"))
+
+	r = testRenamer(t, "Fountain\n\n\n")
+	t.Setenv("UCS_SOURCE_ID", "")
+	r.NoPrompt = true
+	r.Preset.FXName = "Fountain"
+	_, err = r.buildFilename(promptContext{ext: ".wav"})
+	require.ErrorContains(t, err, "SourceID is required", "SourceID is required by default")
+}
+
+func TestTrimSegment(t *testing.T) {
+	for _, tt := range []struct {
+		s       string
+		n       int
+		want    string
+		trimmed bool
+	}{
+		{"close-wet-take2", 20, "close-wet-take2", false},
+		{"close-wet-take2", 0, "close-wet-take2", false},
+		{"close-wet-take2", 11, "close-wet", true},
+		{"close-wet-take2", 9, "close-wet", true},
+		{"close-wet-take2", 10, "close-wet", true},
+		{"closeup", 4, "clos", true},
+		{"ééé-ààà", 5, "ééé", true},
+		{"ééééé", 3, "ééé", true},
+	} {
+		got, trimmed := trimSegment(tt.s, tt.n)
+		require.Equal(t, tt.want, got, "%q to %d", tt.s, tt.n)
+		require.Equal(t, tt.trimmed, trimmed, "%q to %d", tt.s, tt.n)
+	}
+
+	r := testRenamer(t, "Fountain\nvery close wet take\n")
+	r.TrimUserData = 12
+	f, err := r.buildFilename(promptContext{})
+	require.NoError(t, err)
+	require.Equal(t, "very-close", f.UserData)
+	require.Contains(t, r.Stderr.(*bytes.Buffer).String(), `Warning: UserData trimmed from "very-close-wet-take" to "very-close"`)
+}
+
+func TestRunDefaultExt(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "take1")
+	require.NoError(t, os.WriteFile(src, nil, 0o644))
+
+	r := testRenamer(t, "Fountain\n\n")
+	require.ErrorContains(t, r.Run(src, true), "no file name extension found")
+
+	r = testRenamer(t, "Fountain\n\n")
+	r.DefaultExt = "wav"
+	require.NoError(t, r.Run(src, true))
+	require.FileExists(t, filepath.Join(dir, "AMBPark_Fountain_Buddin_Phonogrifter.wav"))
+}
+
+func TestExtDefaults(t *testing.T) {
+	dir := t.TempDir()
+	wav := filepath.Join(dir, "a.wav")
+	flac := filepath.Join(dir, "b.flac")
+	require.NoError(t, os.WriteFile(wav, nil, 0o644))
+	require.NoError(t, os.WriteFile(flac, nil, 0o644))
+
+	r := testRenamer(t, "Fountain\n\nBirds\n\n")
+	t.Setenv("UCS_SOURCE_ID", "")
+	t.Setenv("UCS_EXT_WAV_SOURCE_ID", "Field")
+	t.Setenv("UCS_EXT_FLAC_SOURCE_ID", "Library")
+	require.NoError(t, r.RunAll([]string{wav, flac}, true))
+	require.FileExists(t, filepath.Join(dir, "AMBPark_Fountain_Buddin_Field.wav"))
+	require.FileExists(t, filepath.Join(dir, "AMBPark_Birds_Buddin_Library.flac"))
+
+	// The plain variable takes precedence.
+	src := filepath.Join(dir, "c.wav")
+	require.NoError(t, os.WriteFile(src, nil, 0o644))
+	r = testRenamer(t, "Rain\n\n")
+	t.Setenv("UCS_EXT_WAV_SOURCE_ID", "Field")
+	require.NoError(t, r.Run(src, true))
+	require.FileExists(t, filepath.Join(dir, "AMBPark_Rain_Buddin_Phonogrifter.wav"))
+}
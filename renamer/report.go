@@ -0,0 +1,134 @@
+package renamer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/brettbuddin/ucsrename/ucs"
+)
+
+// FieldReport counts how often each CreatorID, SourceID and CatShort was used across a batch, so
+// that inconsistencies such as two spellings of one CreatorID stand out.
+type FieldReport struct {
+	CreatorIDs map[string]int `json:"creatorIDs"`
+	SourceIDs  map[string]int `json:"sourceIDs"`
+	CatShorts  map[string]int `json:"catShorts"`
+
+	// Warnings lists the values that differ only in case, which are most likely typos.
+	Warnings []string `json:"warnings"`
+}
+
+// NewFieldReport tallies the fields of the given filenames. Empty fields aren't counted, and a CatID
+// missing from the catalog is counted as it is.
+func NewFieldReport(filenames []ucs.Filename) FieldReport {
+	report := FieldReport{
+		CreatorIDs: map[string]int{},
+		SourceIDs:  map[string]int{},
+		CatShorts:  map[string]int{},
+		Warnings:   []string{},
+	}
+	index, _ := ucs.LoadIndex()
+	for _, f := range filenames {
+		if f.CreatorID != "" {
+			report.CreatorIDs[f.CreatorID]++
+		}
+		if f.SourceID != "" {
+			report.SourceIDs[f.SourceID]++
+		}
+		catShort := f.CatID
+		if index != nil {
+			if c, ok := index.Lookup(f.CatID); ok && c.CatShort != "" {
+				catShort = c.CatShort
+			}
+		}
+		report.CatShorts[catShort]++
+	}
+	for _, field := range []struct {
+		name   string
+		counts map[string]int
+	}{
+		{"CreatorID", report.CreatorIDs},
+		{"SourceID", report.SourceIDs},
+	} {
+		for _, variants := range caseVariants(field.counts) {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("%s spellings differ only in case: %s", field.name, strings.Join(variants, ", ")))
+		}
+	}
+	return report
+}
+
+// caseVariants groups the keys of counts that are equal regardless of case, returning only the
+// groups with more than one spelling.
+func caseVariants(counts map[string]int) [][]string {
+	groups := map[string][]string{}
+	for value := range counts {
+		key := strings.ToLower(value)
+		groups[key] = append(groups[key], value)
+	}
+	var variants [][]string
+	for _, key := range sortedKeys(groups) {
+		if g := groups[key]; len(g) > 1 {
+			slices.Sort(g)
+			variants = append(variants, g)
+		}
+	}
+	return variants
+}
+
+// WriteText writes the report as a small table.
+func (fr FieldReport) WriteText(w io.Writer) error {
+	for _, section := range []struct {
+		name   string
+		counts map[string]int
+	}{
+		{"CreatorID", fr.CreatorIDs},
+		{"SourceID", fr.SourceIDs},
+		{"CatShort", fr.CatShorts},
+	} {
+		if _, err := fmt.Fprintf(w, "%s:\n", section.name); err != nil {
+			return err
+		}
+		for _, value := range sortedKeys(section.counts) {
+			if _, err := fmt.Fprintf(w, "  %-20s %d\n", value, section.counts[value]); err != nil {
+				return err
+			}
+		}
+	}
+	for _, warning := range fr.Warnings {
+		if _, err := fmt.Fprintf(w, "Warning: %s\n", warning); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteJSON writes the report as a JSON object.
+func (fr FieldReport) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(fr)
+}
+
+// report writes a FieldReport of the renamed files to Stderr, when Report is set.
+func (r Renamer) report(filenames []ucs.Filename) error {
+	if !r.Report {
+		return nil
+	}
+	fr := NewFieldReport(filenames)
+	if r.ReportJSON {
+		return fr.WriteJSON(r.Stderr)
+	}
+	return fr.WriteText(r.Stderr)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
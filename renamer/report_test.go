@@ -0,0 +1,32 @@
+package renamer
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/brettbuddin/ucsrename/ucs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFieldReport(t *testing.T) {
+	fr := NewFieldReport([]ucs.Filename{
+		{CatID: "AMBPark", FXName: "Fountain", CreatorID: "Buddin", SourceID: "Phonogrifter"},
+		{CatID: "AMBPark", FXName: "Birds", CreatorID: "buddin", SourceID: "Phonogrifter"},
+		{CatID: "DOORWood", FXName: "Slam", CreatorID: "Buddin"},
+	})
+	require.Equal(t, map[string]int{"Buddin": 2, "buddin": 1}, fr.CreatorIDs)
+	require.Equal(t, map[string]int{"Phonogrifter": 2}, fr.SourceIDs)
+	require.Equal(t, map[string]int{"AMB": 2, "DOOR": 1}, fr.CatShorts)
+	require.Equal(t, []string{"CreatorID spellings differ only in case: Buddin, buddin"}, fr.Warnings)
+
+	var buf bytes.Buffer
+	require.NoError(t, fr.WriteText(&buf))
+	require.Contains(t, buf.String(), "CatShort:\n  AMB                  2\n  DOOR                 1\n")
+
+	buf.Reset()
+	require.NoError(t, fr.WriteJSON(&buf))
+	var decoded FieldReport
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	require.Equal(t, fr, decoded)
+}
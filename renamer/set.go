@@ -0,0 +1,94 @@
+package renamer
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/brettbuddin/ucsrename/ucs"
+)
+
+// SetField replaces a single field in every UCS-named file in dir, leaving the other fields intact.
+// Files that don't parse as UCS filenames are reported and skipped, and files that aren't renamable
+// according to Extensions are ignored. The full set of changes is previewed, and a confirmation is
+// required unless forceConfirm is true. The files are then renamed (or copied, linked or moved into
+// OutputDir) just as RunAll does, and a *BatchError is returned if any of them fails.
+func (r Renamer) SetField(dir, field, value string, forceConfirm bool) error {
+	value, err := r.sanitize(value)
+	if err != nil {
+		return err
+	}
+	if err := (&ucs.Filename{}).Set(field, value); err != nil {
+		return err
+	}
+	if strings.EqualFold(field, "cat") || strings.EqualFold(field, "catid") {
+		if value, err = resolveCatID(value); err != nil {
+			return err
+		}
+	}
+
+	entries, err := r.filesystem().ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	var (
+		plan    []Rename
+		skipped int
+	)
+	skip := func(format string, args ...any) {
+		skipped++
+		if !r.QuietSkips {
+			fmt.Fprintf(r.Stderr, format, args...)
+		}
+	}
+	for _, e := range entries {
+		if e.IsDir() || !IsRenamable(e.Name(), r.Extensions) {
+			continue
+		}
+		f, ext, err := r.Affix.Parse(e.Name())
+		if err != nil {
+			skip("Skipping: %v\n", err)
+			continue
+		}
+		if err := f.Set(field, value); err != nil {
+			return err
+		}
+		if _, err := ucs.RoundTrip(f, ext); err != nil {
+			skip("Skipping %s: %v\n", e.Name(), err)
+			continue
+		}
+		p, err := r.newRename(filepath.Join(dir, e.Name()), ext, f)
+		if err != nil {
+			return err
+		}
+		if p.To == p.From {
+			continue
+		}
+		plan = append(plan, p)
+	}
+	r.reportSkips(skipped)
+	if len(plan) == 0 {
+		fmt.Fprintln(r.Stdout, "Nothing to rename")
+		return nil
+	}
+	if err := r.checkPlan(plan); err != nil {
+		return err
+	}
+
+	if err := r.printPlan(plan); err != nil {
+		return err
+	}
+
+	if !forceConfirm {
+		ok, err := r.prompter().Confirm(fmt.Sprintf("%s %d files?", r.verb(), len(plan)))
+		if err != nil || !ok {
+			return err
+		}
+	}
+	batchErr := &BatchError{Total: len(plan)}
+	if _, ok := r.applyPlan(plan, true, batchErr); !ok || batchErr.Failed > 0 {
+		return batchErr
+	}
+	return nil
+}
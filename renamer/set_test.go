@@ -0,0 +1,78 @@
+package renamer
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetField(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"AMBPark_Fountain_Buddin_Phonogrifter.wav",
+		"AMBPark_Birds_Buddin_Phonogrifter_Close.wav",
+		"notes.txt",
+		"fountain.wav",
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0o644))
+	}
+
+	var stdout, stderr bytes.Buffer
+	r := Renamer{Stdout: &stdout, Stderr: &stderr}
+	require.NoError(t, r.SetField(dir, "creator", "BuddinFX", true))
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	require.ElementsMatch(t, []string{
+		"AMBPark_Fountain_BuddinFX_Phonogrifter.wav",
+		"AMBPark_Birds_BuddinFX_Phonogrifter_Close.wav",
+		"notes.txt",
+		"fountain.wav",
+	}, names)
+	require.Contains(t, stderr.String(), "fountain.wav is not a UCS filename")
+	require.NotContains(t, stderr.String(), "notes.txt", "files that aren't renamable are ignored")
+
+	require.Error(t, r.SetField(dir, "creator", "Buddin_FX", true), "underscores are rejected")
+	require.Error(t, r.SetField(dir, "nope", "value", true), "unknown field")
+}
+
+func TestSetFieldQuietSkips(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"AMBPark_Fountain_Buddin_Phonogrifter.wav",
+		"fountain.wav",
+		"birds.wav",
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0o644))
+	}
+
+	var stderr bytes.Buffer
+	r := Renamer{Stdout: &bytes.Buffer{}, Stderr: &stderr, QuietSkips: true}
+	require.NoError(t, r.SetField(dir, "creator", "BuddinFX", true))
+	require.Equal(t, "Skipped 2 files\n[1/1] AMBPark_Fountain_BuddinFX_Phonogrifter.wav\n", stderr.String())
+}
+
+func TestSetFieldTransfer(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "AMBPark_Fountain_Buddin_Phonogrifter.wav")
+	require.NoError(t, os.WriteFile(src, nil, 0o644))
+
+	// -set goes through the same path as other renames, so it copies and logs too.
+	var log bytes.Buffer
+	r := Renamer{Stdout: &bytes.Buffer{}, Stderr: &bytes.Buffer{}, Copy: true, Log: &log}
+	require.NoError(t, r.SetField(dir, "creator", "BuddinFX", true))
+	require.FileExists(t, src)
+	require.FileExists(t, filepath.Join(dir, "AMBPark_Fountain_BuddinFX_Phonogrifter.wav"))
+
+	entries, err := ReadLog(&log)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, "AMBPark_Fountain_BuddinFX_Phonogrifter.wav", entries[0].Renamed)
+}
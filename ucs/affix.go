@@ -0,0 +1,49 @@
+package ucs
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Affix is fixed text placed around a rendered UCS filename, such as a project code required by a
+// client's archive. Names with an affix don't follow the UCS standard. The affix is joined to the name
+// as is, so any separator (e.g. "PROJ-") must be part of it.
+type Affix struct {
+	Prefix string
+	Suffix string
+}
+
+// Validate checks that neither part of the affix contains the filename field delimiter, which would
+// make the name impossible to parse.
+func (a Affix) Validate() error {
+	if strings.Contains(a.Prefix, "_") {
+		return fmt.Errorf("prefix: %w", ErrDelimiter)
+	}
+	if strings.Contains(a.Suffix, "_") {
+		return fmt.Errorf("suffix: %w", ErrDelimiter)
+	}
+	return nil
+}
+
+// Render returns the filename of f surrounded by the affix. The suffix is placed before the
+// extension.
+func (a Affix) Render(f Filename, ext string) string {
+	return a.Prefix + f.Render("") + a.Suffix + ext
+}
+
+// Parse strips the affix from name and parses the remainder like Parse. It's an error for name not
+// to carry the affix.
+func (a Affix) Parse(name string) (Filename, string, error) {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	if !strings.HasPrefix(base, a.Prefix) {
+		return Filename{}, "", fmt.Errorf("%s doesn't start with the prefix %q", name, a.Prefix)
+	}
+	base = strings.TrimPrefix(base, a.Prefix)
+	if !strings.HasSuffix(base, a.Suffix) {
+		return Filename{}, "", fmt.Errorf("%s doesn't end with the suffix %q", name, a.Suffix)
+	}
+	base = strings.TrimSuffix(base, a.Suffix)
+	return Parse(base + ext)
+}
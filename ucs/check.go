@@ -0,0 +1,55 @@
+package ucs
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+)
+
+// CheckBuiltin verifies the integrity of the embedded UCS CSV, regardless of UCS_CSV_FILE. See
+// checkCSV for what's checked.
+func CheckBuiltin() error {
+	f, err := content.Open(builtinFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return checkCSV(f, builtinFile)
+}
+
+// checkCSV verifies a UCS CSV read from src, named name in errors. It checks that every row has the
+// expected columns, that the catalog isn't empty, and that CatIDs are unique. Rows may be in any
+// order; Categories sorts them. The first defect found is returned.
+func checkCSV(src io.Reader, name string) error {
+	reader := csv.NewReader(src)
+	reader.FieldsPerRecord = -1
+
+	seen := map[string]int{}
+	for {
+		r, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		line, _ := reader.FieldPos(0)
+		if len(r) != 6 {
+			return fmt.Errorf("%s:%d: expected 6 columns, found %d", name, line, len(r))
+		}
+		for i, field := range []string{"Category", "SubCategory", "CatID", "CatShort"} {
+			if r[i] == "" {
+				return fmt.Errorf("%s:%d: %s is empty", name, line, field)
+			}
+		}
+		catID := categoryFromRecord(r).CatID
+		if first, ok := seen[catID]; ok {
+			return fmt.Errorf("%s:%d: duplicate CatID %s, first on line %d", name, line, catID, first)
+		}
+		seen[catID] = line
+	}
+	if len(seen) == 0 {
+		return fmt.Errorf("%s contains no categories", name)
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+package ucs
+
+import (
+	"slices"
+
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+// SortByName sorts list by Category and then SubCategory using the collation rules of the given
+// language, so that localized names with accented letters sort the way a reader expects (é alongside
+// e, rather than after z). It's meant for listings that show human-readable names; CatIDs are ASCII
+// identifiers and are sorted byte-wise by Categories.
+func SortByName(list []Category, tag language.Tag) {
+	c := collate.New(tag, collate.IgnoreCase)
+	slices.SortStableFunc(list, func(a, b Category) int {
+		if n := c.CompareString(a.Category, b.Category); n != 0 {
+			return n
+		}
+		return c.CompareString(a.SubCategory, b.SubCategory)
+	})
+}
@@ -0,0 +1,28 @@
+package ucs
+
+// CatalogDiff lists the categories that differ between two catalogs, by CatID.
+type CatalogDiff struct {
+	// Added are the categories only in the new catalog, and Removed those only in the old one. Both
+	// are sorted by CatID.
+	Added   []Category
+	Removed []Category
+}
+
+// Diff compares the CatIDs of two catalogs.
+func Diff(old, new []Category) CatalogDiff {
+	oldIndex, newIndex := NewIndex(old), NewIndex(new)
+	var d CatalogDiff
+	for _, c := range new {
+		if _, ok := oldIndex.byID[c.CatID]; !ok {
+			d.Added = append(d.Added, c)
+		}
+	}
+	for _, c := range old {
+		if _, ok := newIndex.byID[c.CatID]; !ok {
+			d.Removed = append(d.Removed, c)
+		}
+	}
+	sortByCatID(d.Added)
+	sortByCatID(d.Removed)
+	return d
+}
@@ -0,0 +1,41 @@
+package ucs
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// FeedDelimiter separates the CatID from the rest of each line written by WriteFeed. Everything
+// before its first occurrence is the CatID.
+const FeedDelimiter = ":"
+
+// WriteFeed writes the category list in the format consumed by fzf, one category per line sorted by
+// CatID:
+//
+//	CatID: Category SubCategory -- Synonyms (aliases: ...)
+//
+// The aliases are only included when the category has some, so they can be searched for. The CatID
+// always starts the line and is followed by FeedDelimiter, so the selection can be parsed back.
+func WriteFeed(w io.Writer) error {
+	categories, err := Categories()
+	if err != nil {
+		return err
+	}
+	for _, c := range categories {
+		if _, err := fmt.Fprintln(w, FeedLine(c)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FeedLine returns the line WriteFeed writes for c, without its trailing newline. The fields of a
+// custom category file may contain newlines, in which case it spans several lines of the feed.
+func FeedLine(c Category) string {
+	line := fmt.Sprintf("%s%s %s %s -- %s", c.CatID, FeedDelimiter, c.Category, c.SubCategory, c.Synonyms)
+	if len(c.Aliases) > 0 {
+		line += fmt.Sprintf(" (aliases: %s)", strings.Join(c.Aliases, ", "))
+	}
+	return line
+}
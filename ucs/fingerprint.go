@@ -0,0 +1,20 @@
+package ucs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// FingerprintName returns a stable hash of the fields that identify a sound by name: CatID, FXName,
+// CreatorID and SourceID. UserData, UserCategory, the affixes and the extension are ignored, so
+// variants of one sound (e.g. ..._close.wav and ..._far.flac) share a fingerprint. The fields are
+// compared exactly, including case.
+//
+// It's a fingerprint of the name only. It knows nothing about the audio, so two different recordings
+// with the same name collide and two copies of one recording named differently don't.
+func FingerprintName(f Filename) string {
+	fields := []string{f.CatID, f.FXName, f.CreatorID, f.SourceID}
+	sum := sha256.Sum256([]byte(strings.Join(fields, "\x00")))
+	return hex.EncodeToString(sum[:16])
+}
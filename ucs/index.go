@@ -0,0 +1,99 @@
+package ucs
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Index provides constant-time lookups of categories by CatID, by CatID regardless of case, and by
+// alias. It's worth building when looking up many CatIDs, such as once per file in a batch.
+type Index struct {
+	byID    map[string]Category
+	byFold  map[string]Category
+	byAlias map[string]Category
+}
+
+// NewIndex indexes the given categories. When several categories share a key, the first one in the
+// list wins.
+func NewIndex(categories []Category) *Index {
+	idx := &Index{
+		byID:    make(map[string]Category, len(categories)),
+		byFold:  make(map[string]Category, len(categories)),
+		byAlias: map[string]Category{},
+	}
+	add := func(m map[string]Category, key string, c Category) {
+		if _, ok := m[key]; !ok {
+			m[key] = c
+		}
+	}
+	for _, c := range categories {
+		add(idx.byID, c.CatID, c)
+		add(idx.byFold, strings.ToLower(c.CatID), c)
+		for _, alias := range c.Aliases {
+			add(idx.byAlias, alias, c)
+		}
+	}
+	return idx
+}
+
+// Lookup returns the category with the given CatID or, failing that, the given alias.
+func (idx *Index) Lookup(catID string) (Category, bool) {
+	if c, ok := idx.byID[catID]; ok {
+		return c, true
+	}
+	c, ok := idx.byAlias[catID]
+	return c, ok
+}
+
+// Len returns the number of categories indexed by CatID.
+func (idx *Index) Len() int {
+	return len(idx.byID)
+}
+
+// Filename returns a Filename for catID with its Category resolved. catID may be given in any case,
+// and is replaced with the canonical CatID.
+func (idx *Index) Filename(catID string) (Filename, error) {
+	canonical, ok := idx.Canonical(catID)
+	if !ok {
+		return Filename{}, fmt.Errorf("unknown CatID %q", catID)
+	}
+	c := idx.byID[canonical]
+	return Filename{CatID: canonical, Category: &c}, nil
+}
+
+// Canonical returns the CatID matching s, preferring an exact match over a case-insensitive one.
+func (idx *Index) Canonical(s string) (string, bool) {
+	if c, ok := idx.byID[s]; ok {
+		return c.CatID, true
+	}
+	c, ok := idx.byFold[strings.ToLower(s)]
+	return c.CatID, ok
+}
+
+var defaultIndex struct {
+	sync.Mutex
+	source string
+	index  *Index
+}
+
+// LoadIndex returns an Index of Categories(). It's built the first time it's needed and reused
+// afterwards, for as long as the datasource environment variables and CategorySource are unchanged.
+func LoadIndex() (*Index, error) {
+	_, key := currentSource()
+	source := strings.Join([]string{key, os.Getenv("UCS_CATEGORIES_FILE"), os.Getenv("UCS_CSV_FILE"), os.Getenv("UCS_CSV_SHA256")}, "\x00")
+
+	defaultIndex.Lock()
+	defer defaultIndex.Unlock()
+	if defaultIndex.index != nil && defaultIndex.source == source {
+		return defaultIndex.index, nil
+	}
+	categories, err := Categories()
+	if err != nil {
+		return nil, err
+	}
+	defaultIndex.source = source
+	defaultIndex.index = NewIndex(categories)
+	return defaultIndex.index, nil
+}
@@ -0,0 +1,159 @@
+package ucs
+
+import (
+	"slices"
+	"strings"
+)
+
+// Match is a category returned by Search along with its relevance score.
+type Match struct {
+	Category Category
+	Score    int
+}
+
+// Search returns the categories matching query, most relevant first. Every whitespace-separated term
+// in the query must match a category's CatID, Category, SubCategory or Synonyms (case-insensitively)
+// for the category to be included. Exact matches score higher than partial ones. Categories that
+// score the same are ordered by CatID, so a query always returns the same order, whatever the order
+// of the datasource.
+func Search(query string) ([]Match, error) {
+	terms := strings.Fields(strings.ToLower(query))
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	categories, err := Categories()
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []Match
+	for _, c := range categories {
+		score := 0
+		for _, term := range terms {
+			s := scoreTerm(c, term)
+			if s == 0 {
+				score = 0
+				break
+			}
+			score += s
+		}
+		if score > 0 {
+			matches = append(matches, Match{Category: c, Score: score})
+		}
+	}
+	slices.SortStableFunc(matches, compareMatches)
+	return matches, nil
+}
+
+// compareMatches orders matches by descending score, and matches with the same score by CatID.
+func compareMatches(a, b Match) int {
+	if a.Score != b.Score {
+		return b.Score - a.Score
+	}
+	return strings.Compare(a.Category.CatID, b.Category.CatID)
+}
+
+// scoreTerm scores how well a single lowercase term matches the category. Zero means no match.
+func scoreTerm(c Category, term string) int {
+	catID := strings.ToLower(c.CatID)
+	category := strings.ToLower(c.Category)
+	subCategory := strings.ToLower(c.SubCategory)
+	synonym := slices.ContainsFunc(c.SynonymList, func(s string) bool {
+		return strings.ToLower(s) == term
+	})
+
+	switch {
+	case catID == term:
+		return 100
+	case subCategory == term, category == term, synonym:
+		return 50
+	case strings.Contains(catID, term), strings.Contains(category, term), strings.Contains(subCategory, term):
+		return 20
+	case strings.Contains(strings.ToLower(c.Synonyms), term):
+		return 10
+	}
+	return 0
+}
+
+// NearestCatIDs returns up to n CatIDs closest to s by edit distance, ignoring case, nearest first and
+// then by CatID. CatIDs too far from s to be a plausible typo are left out, so the result may be
+// empty. It's for suggesting corrections to an unknown CatID; nil is returned if the categories can't
+// be loaded.
+func NearestCatIDs(s string, n int) []string {
+	categories, err := Categories()
+	if err != nil || n <= 0 {
+		return nil
+	}
+	target := []rune(strings.ToLower(s))
+	limit := len(target) / 4
+	if limit < 1 {
+		limit = 1
+	}
+
+	type candidate struct {
+		catID    string
+		distance int
+	}
+	var candidates []candidate
+	seen := map[string]bool{}
+	for _, c := range categories {
+		if seen[c.CatID] {
+			continue
+		}
+		seen[c.CatID] = true
+		if d := editDistance(target, []rune(strings.ToLower(c.CatID))); d <= limit {
+			candidates = append(candidates, candidate{c.CatID, d})
+		}
+	}
+	slices.SortStableFunc(candidates, func(a, b candidate) int {
+		if a.distance != b.distance {
+			return a.distance - b.distance
+		}
+		return strings.Compare(a.catID, b.catID)
+	})
+
+	if len(candidates) > n {
+		candidates = candidates[:n]
+	}
+	var nearest []string
+	for _, c := range candidates {
+		nearest = append(nearest, c.catID)
+	}
+	return nearest
+}
+
+// editDistance returns the Levenshtein distance between a and b, counting the transposition of two
+// adjacent runes as a single edit, since swapped letters are a common typo (AMBPrak for AMBPark).
+func editDistance(a, b []rune) int {
+	// d[i][j] is the distance between the first i runes of a and the first j runes of b.
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = d[i-1][j-1] + cost
+			if v := d[i-1][j] + 1; v < d[i][j] {
+				d[i][j] = v
+			}
+			if v := d[i][j-1] + 1; v < d[i][j] {
+				d[i][j] = v
+			}
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				if v := d[i-2][j-2] + 1; v < d[i][j] {
+					d[i][j] = v
+				}
+			}
+		}
+	}
+	return d[len(a)][len(b)]
+}
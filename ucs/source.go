@@ -0,0 +1,75 @@
+package ucs
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// CategorySource supplies the categories used by the package, so that they can come from a database
+// or an API instead of a CSV file. Categories may be returned in any order.
+type CategorySource interface {
+	Categories() ([]Category, error)
+}
+
+// CategorySourceFunc adapts an ordinary function to a CategorySource.
+type CategorySourceFunc func() ([]Category, error)
+
+// Categories calls f.
+func (f CategorySourceFunc) Categories() ([]Category, error) {
+	return f()
+}
+
+// FileSource is the default CategorySource: the file named by UCS_CATEGORIES_FILE or UCS_CSV_FILE,
+// or else the builtin CSV file.
+type FileSource struct{}
+
+// Categories reads the categories of the file, in file order.
+func (FileSource) Categories() ([]Category, error) {
+	f, name, err := open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readCategories(f, name)
+}
+
+// SourceName describes where the categories come from: the file named by UCS_CATEGORIES_FILE or
+// UCS_CSV_FILE, the builtin CSV file, or a CategorySource set with SetCategorySource.
+func SourceName() string {
+	if source, _ := currentSource(); source != (FileSource{}) {
+		return "custom category source"
+	}
+	for _, key := range []string{"UCS_CATEGORIES_FILE", "UCS_CSV_FILE"} {
+		if fp := os.Getenv(key); fp != "" {
+			return fmt.Sprintf("%s (from %s)", fp, key)
+		}
+	}
+	return fmt.Sprintf("builtin UCS v%s list (%s)", Version, builtinFile)
+}
+
+var categorySource struct {
+	sync.Mutex
+	source     CategorySource
+	generation int
+}
+
+// SetCategorySource replaces the datasource of Categories, Lookup, Search and the other functions of
+// the package that read the categories. A nil source restores FileSource. Any cached Index is
+// rebuilt from the new source when it's next needed.
+func SetCategorySource(s CategorySource) {
+	categorySource.Lock()
+	defer categorySource.Unlock()
+	categorySource.source = s
+	categorySource.generation++
+}
+
+// currentSource returns the CategorySource in use, along with a key identifying it for caching.
+func currentSource() (CategorySource, string) {
+	categorySource.Lock()
+	defer categorySource.Unlock()
+	if categorySource.source == nil {
+		return FileSource{}, ""
+	}
+	return categorySource.source, fmt.Sprintf("source %d", categorySource.generation)
+}
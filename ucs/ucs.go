@@ -2,69 +2,516 @@
 package ucs
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"embed"
 	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"io/fs"
 	"os"
+	"path/filepath"
+	"regexp"
 	"slices"
 	"strings"
+	"unicode/utf8"
 )
 
 //go:embed *.csv
 var content embed.FS
 
-func open() (fs.File, error) {
-	if fp := os.Getenv("UCS_CSV_FILE"); fp != "" {
-		return os.Open(fp)
+// Version is the version of the UCS category list embedded in the program.
+const Version = "8.2"
+
+// builtinFile is the name of the embedded UCS CSV file.
+const builtinFile = "UCS-v" + Version + ".csv"
+
+// open opens the category datasource, returning it along with its name. UCS_CATEGORIES_FILE takes
+// precedence over UCS_CSV_FILE, and the builtin CSV file is used when neither is set. When
+// UCS_CSV_SHA256 pins the datasource, it's read into memory and verified before it's returned, so
+// that what's read is exactly what was checked.
+func open() (io.ReadCloser, string, error) {
+	f, name, err := openFile()
+	if err != nil {
+		return nil, name, err
+	}
+	expected := os.Getenv("UCS_CSV_SHA256")
+	if expected == "" {
+		return f, name, nil
+	}
+	defer f.Close()
+	b, err := io.ReadAll(f)
+	if err != nil {
+		return nil, name, err
+	}
+	if sum := checksum(b); !strings.EqualFold(sum, strings.TrimSpace(expected)) {
+		return nil, name, fmt.Errorf("%s has SHA-256 %s, but UCS_CSV_SHA256 expects %s", name, sum, expected)
+	}
+	return io.NopCloser(bytes.NewReader(b)), name, nil
+}
+
+// openFile opens the file named by UCS_CATEGORIES_FILE or UCS_CSV_FILE, or else the builtin CSV file.
+func openFile() (fs.File, string, error) {
+	for _, key := range []string{"UCS_CATEGORIES_FILE", "UCS_CSV_FILE"} {
+		if fp := os.Getenv(key); fp != "" {
+			info, err := os.Stat(fp)
+			if err != nil {
+				return nil, fp, err
+			}
+			if info.IsDir() {
+				return nil, fp, fmt.Errorf("%s is a directory", key)
+			}
+			f, err := os.Open(fp)
+			return f, fp, err
+		}
+	}
+	f, err := content.Open(builtinFile)
+	return f, builtinFile, err
+}
+
+// Checksum returns the name of the category datasource, as with open, and the hex-encoded SHA-256 of
+// its contents. It's the value UCS_CSV_SHA256 is compared against.
+func Checksum() (string, string, error) {
+	f, name, err := openFile()
+	if err != nil {
+		return name, "", err
+	}
+	defer f.Close()
+	b, err := io.ReadAll(f)
+	if err != nil {
+		return name, "", err
 	}
-	return content.Open("UCS-v8.2.csv")
+	return name, checksum(b), nil
+}
+
+func checksum(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
 }
 
 // Category is UCS category.
 type Category struct {
-	Category    string
-	SubCategory string
-	CatID       string
-	CatShort    string
-	Synonyms    string
+	Category     string `json:"category"`
+	SubCategory  string `json:"subCategory"`
+	CatID        string `json:"catID"`
+	CatShort     string `json:"catShort"`
+	Explanations string `json:"explanations"`
+	Synonyms     string `json:"synonyms"`
+
+	// SynonymList is Synonyms split on commas, with surrounding whitespace trimmed and empty entries
+	// dropped.
+	SynonymList []string `json:"-"`
+
+	// Aliases are alternative names that resolve to the CatID. They come from an optional seventh,
+	// colon-separated, column in custom CSV files.
+	Aliases []string `json:"aliases,omitempty"`
 }
 
-// Categories returns the full list of UCS categories.
+// Categories returns the full list of UCS categories, sorted by CatID in ascending order.
 //
 // The builtin CSV file is used as a datasource unless UCS_CSV_FILE is set, in which case that file
 // will be used instead. Compatible CSV files are availble at https://universalcategorysystem.com.
+// UCS_CATEGORIES_FILE may be used in place of UCS_CSV_FILE, and takes precedence over it. Files with
+// a .json extension are read as a JSON array of Category objects rather than as CSV. When
+// UCS_CSV_SHA256 is set, the file in use must have that SHA-256, or an error is returned. A
+// CategorySource set with SetCategorySource replaces all of them.
 func Categories() ([]Category, error) {
-	f, err := open()
+	list, err := CategoriesUnsorted()
+	if err != nil {
+		return nil, err
+	}
+	sortByCatID(list)
+	return list, nil
+}
+
+// CategoriesUnsorted returns the full list of UCS categories in the order they appear in the
+// datasource, skipping the sort performed by Categories(). Ascending CatID order is only guaranteed
+// by Categories().
+func CategoriesUnsorted() ([]Category, error) {
+	source, _ := currentSource()
+	return source.Categories()
+}
+
+// CategoriesFile reads the categories of the file at path, in file order, regardless of
+// UCS_CATEGORIES_FILE and UCS_CSV_FILE. Files ending in .json are read as JSON, and others as CSV.
+func CategoriesFile(path string) ([]Category, error) {
+	f, err := os.Open(path)
 	if err != nil {
 		return nil, err
 	}
+	defer f.Close()
+	return readCategories(f, path)
+}
 
-	reader := csv.NewReader(f)
-	records, err := reader.ReadAll()
+// BuiltinCategories returns the categories of the embedded UCS CSV, regardless of
+// UCS_CATEGORIES_FILE and UCS_CSV_FILE, sorted by CatID.
+func BuiltinCategories() ([]Category, error) {
+	f, err := content.Open(builtinFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	list, err := readCategories(f, builtinFile)
 	if err != nil {
 		return nil, err
 	}
+	sortByCatID(list)
+	return list, nil
+}
+
+// readCategories reads categories from f, choosing the format by the extension of name.
+func readCategories(f io.Reader, name string) ([]Category, error) {
+	if strings.EqualFold(filepath.Ext(name), ".json") {
+		var list []Category
+		err := eachJSONCategory(f, func(c Category) error {
+			list = append(list, c)
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		return list, nil
+	}
+	list, _, err := CategoriesFrom(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return list, nil
+}
+
+// ParseWarning describes a CSV row that was skipped while reading categories.
+type ParseWarning struct {
+	Line    int
+	Message string
+}
+
+func (w ParseWarning) String() string {
+	return fmt.Sprintf("line %d: %s", w.Line, w.Message)
+}
+
+// CategoriesFrom reads categories from a UCS CSV in file order. Rows that can't be used, such as those
+// with the wrong number of columns, are skipped and reported as warnings with their line numbers.
+// An error is returned only if the CSV itself can't be read.
+func CategoriesFrom(src io.Reader) ([]Category, []ParseWarning, error) {
+	var (
+		list     []Category
+		warnings []ParseWarning
+	)
+	err := eachCSVCategory(src, func(c Category) error {
+		list = append(list, c)
+		return nil
+	}, func(w ParseWarning) {
+		warnings = append(warnings, w)
+	})
+	if err != nil {
+		return nil, warnings, err
+	}
+	return list, warnings, nil
+}
+
+// Lookup returns the category with the given CatID. Aliases are also accepted, returning the
+// category they belong to; CatIDs take precedence over aliases. The categories are indexed on first
+// use, so repeated lookups are cheap.
+func Lookup(catID string) (Category, error) {
+	idx, err := LoadIndex()
+	if err != nil {
+		return Category{}, err
+	}
+	c, ok := idx.Lookup(catID)
+	if !ok {
+		return Category{}, fmt.Errorf("unknown CatID: %s", catID)
+	}
+	return c, nil
+}
+
+// CanonicalCatID matches s case-insensitively against the CatIDs of the loaded categories and returns
+// the CatID as it is cased in the catalog. An exact match takes precedence over a case-insensitive
+// one. The boolean reports whether a match was found.
+func CanonicalCatID(s string) (string, bool, error) {
+	idx, err := LoadIndex()
+	if err != nil {
+		return "", false, err
+	}
+	catID, ok := idx.Canonical(s)
+	return catID, ok, nil
+}
+
+var catIDFormat = regexp.MustCompile(`^[A-Z]{2,}[A-Za-z0-9]*$`)
+
+// ValidCatIDFormat reports whether s is shaped like a CatID: an uppercase CatShort of at least two
+// letters, optionally followed by a subcategory code of letters and digits (e.g. AMBPark). It doesn't
+// check that the CatID exists.
+func ValidCatIDFormat(s string) bool {
+	return catIDFormat.MatchString(s)
+}
+
+// FolderFor returns the names used for organizing files of the given CatID into folders: the
+// uppercase Category (e.g. AMBIENCE) and the CatShort (e.g. AMB). Custom category files sometimes
+// leave Category or CatShort empty; that's an error rather than a blank folder name.
+func FolderFor(catID string) (category, catShort string, err error) {
+	c, err := Lookup(catID)
+	if err != nil {
+		return "", "", err
+	}
+	if c.Category == "" {
+		return "", "", fmt.Errorf("CatID %s has no Category to name its folder after", c.CatID)
+	}
+	if c.CatShort == "" {
+		return "", "", fmt.Errorf("CatID %s has no CatShort to name its folder after", c.CatID)
+	}
+	return strings.ToUpper(c.Category), c.CatShort, nil
+}
+
+// sortByCatID sorts list by CatID. The sort is stable, so categories sharing a CatID keep their
+// datasource order and the numbering of -list-categories -numbered is the same on every run.
+func sortByCatID(list []Category) {
+	slices.SortStableFunc(list, compareCatID)
+}
+
+func compareCatID(a, b Category) int {
+	return strings.Compare(a.CatID, b.CatID)
+}
+
+// EachCategory calls fn for every UCS category as it is read from the CSV, without loading the full
+// list into memory. Iteration stops at the first error returned by fn, and that error is returned.
+//
+// Categories are visited in the order the datasource lists them, not in the CatID order of
+// Categories(), since sorting would mean loading them all first. Callers that need CatID order must
+// sort themselves. The datasource is the same as Categories(); only files are streamed, and the
+// categories of any other CategorySource are visited once it has returned them. A file pinned by
+// UCS_CSV_SHA256 is read in full and verified before any category is visited.
+func EachCategory(fn func(Category) error) error {
+	if source, key := currentSource(); key != "" {
+		list, err := source.Categories()
+		if err != nil {
+			return err
+		}
+		for _, c := range list {
+			if err := fn(c); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	f, name, err := open()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
 
-	var list []Category
-	for _, r := range records {
-		if len(r) != 6 {
+	if strings.EqualFold(filepath.Ext(name), ".json") {
+		return eachJSONCategory(f, fn)
+	}
+	return eachCSVCategory(f, fn, nil)
+}
+
+// splitSynonyms splits a comma-separated list of synonyms, trimming each and dropping empty ones.
+func splitSynonyms(s string) []string {
+	var list []string
+	for _, syn := range strings.Split(s, ",") {
+		if syn = strings.TrimSpace(syn); syn != "" {
+			list = append(list, syn)
+		}
+	}
+	return list
+}
+
+// eachCSVCategory calls fn for every category in a UCS CSV. Rows that are skipped are passed to warn,
+// which may be nil.
+func eachCSVCategory(src io.Reader, fn func(Category) error, warn func(ParseWarning)) error {
+	reader := csv.NewReader(src)
+	reader.FieldsPerRecord = -1
+	for {
+		r, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(r) != 6 && len(r) != 7 {
+			if warn != nil {
+				line, _ := reader.FieldPos(0)
+				warn(ParseWarning{Line: line, Message: fmt.Sprintf("expected 6 or 7 columns, found %d", len(r))})
+			}
 			continue
 		}
-		list = append(list, Category{
-			Category:    r[0],
-			SubCategory: r[1],
-			CatID:       r[2],
-			CatShort:    r[3],
-			Synonyms:    r[5],
-		})
+		if err := fn(categoryFromRecord(r)); err != nil {
+			return err
+		}
 	}
-	slices.SortFunc(list, func(a, b Category) int {
-		if a.CatID < b.CatID {
-			return -1
+}
+
+func eachJSONCategory(src io.Reader, fn func(Category) error) error {
+	dec := json.NewDecoder(src)
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != json.Delim('[') {
+		return fmt.Errorf("expected a JSON array of categories")
+	}
+	for dec.More() {
+		var c Category
+		if err := dec.Decode(&c); err != nil {
+			return err
+		}
+		c.SynonymList = splitSynonyms(c.Synonyms)
+		if err := fn(c); err != nil {
+			return err
 		}
-		return 1
+	}
+	_, err = dec.Token()
+	return err
+}
+
+// categoryFromRecord converts a 6-column CSV record into a Category. An optional seventh column
+// holds colon-separated aliases.
+func categoryFromRecord(r []string) Category {
+	c := Category{
+		Category:     r[0],
+		SubCategory:  r[1],
+		CatID:        r[2],
+		CatShort:     r[3],
+		Explanations: r[4],
+		Synonyms:     r[5],
+		SynonymList:  splitSynonyms(r[5]),
+	}
+	if len(r) > 6 {
+		for _, alias := range strings.Split(r[6], ":") {
+			if alias = strings.TrimSpace(alias); alias != "" {
+				c.Aliases = append(c.Aliases, alias)
+			}
+		}
+	}
+	return c
+}
+
+// WriteCSV writes categories to w in the canonical 6-column UCS CSV format: Category, SubCategory,
+// CatID, CatShort, Explanations and Synonyms. If any category has aliases, a seventh column of
+// colon-separated aliases is written for every row.
+func WriteCSV(w io.Writer, categories []Category) error {
+	withAliases := slices.ContainsFunc(categories, func(c Category) bool {
+		return len(c.Aliases) > 0
 	})
-	return list, nil
+
+	cw := csv.NewWriter(w)
+	for _, c := range categories {
+		record := []string{c.Category, c.SubCategory, c.CatID, c.CatShort, c.Explanations, c.Synonyms}
+		if withAliases {
+			record = append(record, strings.Join(c.Aliases, ":"))
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WritableCategoryFile returns the path of the custom CSV file that AppendCategory writes to, or an
+// error explaining why there isn't one.
+func WritableCategoryFile() (string, error) {
+	path := os.Getenv("UCS_CATEGORIES_FILE")
+	if path == "" {
+		path = os.Getenv("UCS_CSV_FILE")
+	}
+	if path == "" {
+		return "", fmt.Errorf("the embedded UCS CSV is read-only; set UCS_CSV_FILE to a custom CSV file to add categories")
+	}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		return "", fmt.Errorf("%s: categories can only be added to CSV files", path)
+	}
+	return path, nil
+}
+
+// AppendCategory appends c as a row to the custom CSV file named by UCS_CATEGORIES_FILE or
+// UCS_CSV_FILE, returning the file's path. The embedded UCS CSV is read-only, so it's an error when
+// neither is set, as it is for JSON files. Category, SubCategory, CatID and CatShort are required,
+// and the CatID must not already be in the file, compared case-insensitively and against aliases.
+// The cached Index is dropped, so the new category is seen by the next lookup.
+func AppendCategory(c Category) (string, error) {
+	path, err := WritableCategoryFile()
+	if err != nil {
+		return "", err
+	}
+	for _, field := range []struct{ name, value string }{
+		{"Category", c.Category},
+		{"SubCategory", c.SubCategory},
+		{"CatID", c.CatID},
+		{"CatShort", c.CatShort},
+	} {
+		if strings.TrimSpace(field.value) == "" {
+			return "", fmt.Errorf("%s is required", field.name)
+		}
+	}
+	if !ValidCatIDFormat(c.CatID) {
+		return "", fmt.Errorf("%q doesn't look like a CatID (e.g. AMBPark)", c.CatID)
+	}
+
+	existing, err := CategoriesFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+	idx := NewIndex(existing)
+	if catID, ok := idx.Canonical(c.CatID); ok {
+		return "", fmt.Errorf("%s: CatID %s already exists", path, catID)
+	}
+	if taken, ok := idx.Lookup(c.CatID); ok {
+		return "", fmt.Errorf("%s: %s is already an alias of %s", path, c.CatID, taken.CatID)
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return "", err
+	}
+	if err := appendCSVRow(f, c, slices.ContainsFunc(existing, func(c Category) bool {
+		return len(c.Aliases) > 0
+	})); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+
+	defaultIndex.Lock()
+	defaultIndex.index = nil
+	defaultIndex.Unlock()
+	return path, nil
+}
+
+// appendCSVRow writes c as a CSV row at the end of f, first adding a newline if the file doesn't end
+// with one. withAliases keeps the column count in step with files that have an aliases column.
+func appendCSVRow(f *os.File, c Category, withAliases bool) error {
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if size := info.Size(); size > 0 {
+		last := make([]byte, 1)
+		if _, err := f.ReadAt(last, size-1); err != nil {
+			return err
+		}
+		if last[0] != '\n' {
+			if _, err := f.Write([]byte("\n")); err != nil {
+				return err
+			}
+		}
+	}
+	record := []string{c.Category, c.SubCategory, c.CatID, c.CatShort, c.Explanations, c.Synonyms}
+	if withAliases {
+		record = append(record, strings.Join(c.Aliases, ":"))
+	}
+	cw := csv.NewWriter(f)
+	if err := cw.Write(record); err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
 }
 
 // Filename is a UCS filename. Individual segments *must not* contain underscores, because
@@ -75,15 +522,276 @@ type Filename struct {
 	CreatorID string
 	SourceID  string
 	UserData  string
+
+	// UserCategory is optional, and is appended to the CatID segment with a dash. With
+	// BracketUserCategory it's rendered in the vendor notation instead, in brackets ahead of the
+	// CatID.
+	UserCategory        string
+	BracketUserCategory bool
+
+	// Category is the category CatID refers to, when the Filename was built with Index.Filename. It
+	// lets the full taxonomy be displayed without another lookup. Render ignores it, and it's left out
+	// of JSON unless WithCategory is used.
+	Category *Category `json:"-"`
+}
+
+// FilenameJSON is the JSON form of a Filename that includes its resolved Category.
+type FilenameJSON struct {
+	Filename
+	Category *Category `json:"category,omitempty"`
+}
+
+// WithCategory returns f in the form that includes its Category when encoded as JSON.
+func (f Filename) WithCategory() FilenameJSON {
+	return FilenameJSON{Filename: f, Category: f.Category}
 }
 
 // Render returns the assembled filename with the given extension:
 //
-//	CatID_FXName_CreatorID_SourceID_UserData.Extention
+//	CatID-UserCategory_FXName_CreatorID_SourceID_UserData.Extention
+//	[UserCategory]CatID_FXName_CreatorID_SourceID_UserData.Extention
+//
+// Empty segments at the end are left out, along with their delimiter. An empty segment followed by
+// one that isn't empty is kept, so that the later segments stay in their positions.
 func (f Filename) Render(ext string) string {
-	segs := []string{f.CatID, f.FXName, f.CreatorID, f.SourceID}
-	if f.UserData != "" {
-		segs = append(segs, f.UserData)
+	return strings.Join(f.segments(), "_") + ext
+}
+
+// segments returns the segments of the filename, without the empty ones at the end. CatID and
+// FXName are always included.
+func (f Filename) segments() []string {
+	segs := []string{f.catIDSegment(), f.FXName, f.CreatorID, f.SourceID, f.UserData}
+	n := len(segs)
+	for n > 2 && segs[n-1] == "" {
+		n--
+	}
+	return segs[:n]
+}
+
+// catIDSegment returns the first segment of the filename, combining the CatID and UserCategory.
+func (f Filename) catIDSegment() string {
+	switch {
+	case f.UserCategory == "":
+		return f.CatID
+	case f.BracketUserCategory:
+		return "[" + f.UserCategory + "]" + f.CatID
+	default:
+		return f.CatID + "-" + f.UserCategory
+	}
+}
+
+// ErrDelimiter is returned when a segment contains the filename field delimiter.
+var ErrDelimiter = errors.New("value cannot contain \"_\", because it is the filename field delimiter")
+
+// SanitizeSegment prepares free-form text for use as a filename segment. Surrounding whitespace is
+// trimmed and inner runs of whitespace are replaced with dashes. Text containing an underscore is
+// rejected with ErrDelimiter.
+func SanitizeSegment(s string) (string, error) {
+	return SanitizeSegmentWith(s, "-")
+}
+
+// SanitizeSegmentWith is SanitizeSegment with inner runs of whitespace replaced with space instead of
+// a dash. An empty space removes them, so "Central Park" becomes CentralPark.
+func SanitizeSegmentWith(s, space string) (string, error) {
+	if strings.Contains(s, "_") {
+		return "", ErrDelimiter
+	}
+	return strings.Join(strings.Fields(s), space), nil
+}
+
+// ValidateSpaceChar checks that space can stand in for whitespace in a segment: it must be empty or a
+// single character that is neither whitespace, a path separator nor the field delimiter.
+func ValidateSpaceChar(space string) error {
+	switch {
+	case space == "":
+		return nil
+	case space == "_":
+		return fmt.Errorf("%q can't replace spaces, because it is the filename field delimiter", space)
+	case utf8.RuneCountInString(space) != 1:
+		return fmt.Errorf("%q can't replace spaces: expected a single character", space)
+	case strings.TrimSpace(space) == "" || strings.ContainsAny(space, `/\`):
+		return fmt.Errorf("%q can't replace spaces in a filename", space)
+	}
+	return nil
+}
+
+// DefaultRequired are the fields the UCS standard requires.
+var DefaultRequired = []string{"CatID", "FXName", "CreatorID", "SourceID"}
+
+// ParseRequired parses a comma-separated list of field names, in any of the forms accepted by Set,
+// into the canonical names of the fields to require. CatID and FXName are always included, since
+// every filename starts with them.
+func ParseRequired(list string) ([]string, error) {
+	required := []string{"CatID", "FXName"}
+	for _, s := range strings.Split(list, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		name, ok := FieldName(s)
+		if !ok {
+			return nil, fmt.Errorf("unknown field: %s", s)
+		}
+		if !slices.Contains(required, name) {
+			required = append(required, name)
+		}
+	}
+	return required, nil
+}
+
+// Validate checks that the fields UCS requires (DefaultRequired) are present and that no segment
+// contains an underscore.
+func (f Filename) Validate() error {
+	return f.ValidateRequired(DefaultRequired)
+}
+
+// ValidateRequired is like Validate, but checks for the presence of the named fields instead. Any
+// field can be required, although names missing CreatorID or SourceID don't follow the UCS standard.
+func (f Filename) ValidateRequired(required []string) error {
+	segs := []struct {
+		name  string
+		value string
+	}{
+		{"CatID", f.CatID},
+		{"FXName", f.FXName},
+		{"CreatorID", f.CreatorID},
+		{"SourceID", f.SourceID},
+		{"UserData", f.UserData},
+		{"UserCategory", f.UserCategory},
+	}
+	for _, s := range segs {
+		if slices.Contains(required, s.name) && s.value == "" {
+			return fmt.Errorf("%s is required", s.name)
+		}
+		if strings.Contains(s.value, "_") {
+			return fmt.Errorf("%s: %w", s.name, ErrDelimiter)
+		}
+	}
+	if f.BracketUserCategory && strings.ContainsAny(f.UserCategory, "[]") {
+		return fmt.Errorf("UserCategory can't contain brackets in the bracket notation")
+	}
+	return nil
+}
+
+// Set assigns value to the named field. Field names are matched case-insensitively against the UCS
+// field names (CatID, UserCategory, FXName, CreatorID, SourceID and UserData) and their short forms
+// (cat, usercat, fx, creator, source and user).
+func (f *Filename) Set(field, value string) error {
+	name, ok := FieldName(field)
+	if !ok {
+		return fmt.Errorf("unknown field: %s", field)
+	}
+	switch name {
+	case "CatID":
+		f.CatID = value
+	case "UserCategory":
+		f.UserCategory = value
+	case "FXName":
+		f.FXName = value
+	case "CreatorID":
+		f.CreatorID = value
+	case "SourceID":
+		f.SourceID = value
+	case "UserData":
+		f.UserData = value
+	}
+	return nil
+}
+
+// FieldName returns the UCS name of the field given by any of the names accepted by Set.
+func FieldName(field string) (string, bool) {
+	switch strings.ToLower(field) {
+	case "catid", "cat":
+		return "CatID", true
+	case "usercategory", "usercat":
+		return "UserCategory", true
+	case "fxname", "fx":
+		return "FXName", true
+	case "creatorid", "creator":
+		return "CreatorID", true
+	case "sourceid", "source":
+		return "SourceID", true
+	case "userdata", "user":
+		return "UserData", true
+	}
+	return "", false
+}
+
+// Parse parses a filename produced by Render back into its segments. The extension, including its
+// leading dot, is returned alongside the Filename. A UserCategory in the bracket notation sets
+// BracketUserCategory, so the name renders the same way again.
+func Parse(name string) (Filename, string, error) {
+	ext := filepath.Ext(name)
+	segs := strings.Split(strings.TrimSuffix(name, ext), "_")
+	if len(segs) != 4 && len(segs) != 5 {
+		return Filename{}, "", fmt.Errorf("%s is not a UCS filename: expected 4 or 5 segments, found %d", name, len(segs))
+	}
+
+	var (
+		catID, userCategory string
+		bracketed           bool
+	)
+	if rest, ok := strings.CutPrefix(segs[0], "["); ok {
+		if userCategory, catID, ok = strings.Cut(rest, "]"); !ok {
+			return Filename{}, "", fmt.Errorf("%s is not a UCS filename: unterminated bracket", name)
+		}
+		bracketed = true
+	} else {
+		// CatIDs never contain a dash, so the first one starts the UserCategory.
+		catID, userCategory, _ = strings.Cut(segs[0], "-")
+	}
+	f := Filename{
+		CatID:               catID,
+		UserCategory:        userCategory,
+		BracketUserCategory: bracketed && userCategory != "",
+		FXName:              segs[1],
+		CreatorID:           segs[2],
+		SourceID:            segs[3],
+	}
+	if len(segs) == 5 {
+		f.UserData = segs[4]
+	}
+	if err := f.Validate(); err != nil {
+		return Filename{}, "", fmt.Errorf("%s is not a UCS filename: %w", name, err)
+	}
+	return f, ext, nil
+}
+
+// RoundTrip renders f with the given extension and parses the result, returning the parsed Filename.
+// An error is returned if the name doesn't parse back to f and ext, meaning Render and Parse disagree
+// about it.
+func RoundTrip(f Filename, ext string) (Filename, error) {
+	name := f.Render(ext)
+	parsed, parsedExt, err := Parse(name)
+	if err != nil {
+		return parsed, err
+	}
+	// Parsing can't recover the resolved category.
+	f.Category = nil
+	if parsed != f || parsedExt != ext {
+		return parsed, fmt.Errorf("%s doesn't parse back to the fields it was rendered from", name)
+	}
+	return parsed, nil
+}
+
+// WriteTo writes the filename that Render(ext) returns to w, without assembling it in memory first.
+// It returns the number of bytes written.
+func (f Filename) WriteTo(w io.Writer, ext string) (int64, error) {
+	var parts []string
+	for i, s := range f.segments() {
+		if i > 0 {
+			parts = append(parts, "_")
+		}
+		parts = append(parts, s)
+	}
+	parts = append(parts, ext)
+
+	var total int64
+	for _, p := range parts {
+		n, err := io.WriteString(w, p)
+		total += int64(n)
+		if err != nil {
+			return total, err
+		}
 	}
-	return strings.Join(segs, "_") + ext
+	return total, nil
 }
@@ -1,12 +1,18 @@
 package ucs
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math/rand"
 	"os"
 	"path/filepath"
 	"slices"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	"golang.org/x/text/language"
 )
 
 func TestBuiltinCategories(t *testing.T) {
@@ -59,3 +65,760 @@ func TestFilenameRendering(t *testing.T) {
 	}
 	require.Equal(t, "AMBPark_Central Park Bethesda Fountain_Buddin_Phonogrifter_Clippy.wav", filename.Render(".wav"))
 }
+
+func TestEachCategory(t *testing.T) {
+	var count int
+	err := EachCategory(func(c Category) error {
+		count++
+		return nil
+	})
+	require.NoError(t, err)
+
+	categories, err := Categories()
+	require.NoError(t, err)
+	require.Equal(t, len(categories), count)
+
+	stop := errors.New("stop")
+	count = 0
+	err = EachCategory(func(c Category) error {
+		count++
+		if count == 3 {
+			return stop
+		}
+		return nil
+	})
+	require.ErrorIs(t, err, stop)
+	require.Equal(t, 3, count, "iteration stops at the first error")
+
+	path := filepath.Join(t.TempDir(), "custom.csv")
+	csv := "AIR,HISS,AIRHiss,AIR,,\nAIR,SECOND,AIRBlow,AIR,,\nAIR,FIRST,AIRBlow,AIR,,\n"
+	require.NoError(t, os.WriteFile(path, []byte(csv), 0o644))
+	reset := setEnv("UCS_CSV_FILE", path)
+	t.Cleanup(reset)
+
+	var visited []string
+	require.NoError(t, EachCategory(func(c Category) error {
+		visited = append(visited, c.SubCategory)
+		return nil
+	}))
+	require.Equal(t, []string{"HISS", "SECOND", "FIRST"}, visited, "categories are visited in file order")
+}
+
+func TestFilenameParsing(t *testing.T) {
+	f, ext, err := Parse("AMBPark_Central-Park-Bethesda-Fountain_Buddin_Phonogrifter_Clippy.wav")
+	require.NoError(t, err)
+	require.Equal(t, ".wav", ext)
+	require.Equal(t, Filename{
+		CatID:     "AMBPark",
+		FXName:    "Central-Park-Bethesda-Fountain",
+		CreatorID: "Buddin",
+		SourceID:  "Phonogrifter",
+		UserData:  "Clippy",
+	}, f)
+
+	f, _, err = Parse("AMBPark_Fountain_Buddin_Phonogrifter.wav")
+	require.NoError(t, err)
+	require.Empty(t, f.UserData, "UserData is optional")
+
+	_, _, err = Parse("AMBPark_Fountain.wav")
+	require.Error(t, err, "too few segments")
+
+	_, _, err = Parse("AMBPark__Buddin_Phonogrifter.wav")
+	require.Error(t, err, "empty FXName")
+}
+
+func TestFilenameSet(t *testing.T) {
+	var f Filename
+	require.NoError(t, f.Set("creator", "BuddinFX"))
+	require.NoError(t, f.Set("SourceID", "Phonogrifter"))
+	require.Equal(t, "BuddinFX", f.CreatorID)
+	require.Equal(t, "Phonogrifter", f.SourceID)
+	require.Error(t, f.Set("nope", "value"))
+}
+
+func TestSearch(t *testing.T) {
+	matches, err := Search("ambpark")
+	require.NoError(t, err)
+	require.NotEmpty(t, matches)
+	require.Equal(t, "AMBPark", matches[0].Category.CatID, "exact CatID ranks first")
+
+	matches, err = Search("guns automatic")
+	require.NoError(t, err)
+	require.NotEmpty(t, matches)
+	require.Equal(t, "GUNAuto", matches[0].Category.CatID)
+	for _, m := range matches {
+		require.Contains(t, []string{"GUNS"}, m.Category.Category, "every term must match")
+	}
+
+	matches, err = Search("zzzznotacategory")
+	require.NoError(t, err)
+	require.Empty(t, matches)
+}
+
+func TestCompareMatches(t *testing.T) {
+	match := func(catID string, score int) Match {
+		return Match{Category: Category{CatID: catID}, Score: score}
+	}
+	// Tied matches are given out of CatID order, as a CategorySource or a stable sort by score alone
+	// would leave them.
+	matches := []Match{
+		match("STEAMHiss", 50),
+		match("AIRHiss", 50),
+		match("AIRBlow", 100),
+		match("TIREHiss", 50),
+		match("GASLeak", 20),
+		match("ANMLHiss", 50),
+	}
+	slices.SortStableFunc(matches, compareMatches)
+
+	var got []string
+	for _, m := range matches {
+		got = append(got, m.Category.CatID)
+	}
+	require.Equal(t, []string{"AIRBlow", "AIRHiss", "ANMLHiss", "STEAMHiss", "TIREHiss", "GASLeak"}, got)
+}
+
+func TestNearestCatIDs(t *testing.T) {
+	require.Equal(t, []string{"AMBPark"}, NearestCatIDs("AMBPrk", 3))
+	require.Equal(t, []string{"AMBPark"}, NearestCatIDs("ambprak", 3), "case is ignored and swaps are one edit")
+	require.Empty(t, NearestCatIDs("ZZZZZZZZ", 3))
+	require.Empty(t, NearestCatIDs("AMBPrk", 0))
+
+	require.Equal(t, 0, editDistance([]rune("park"), []rune("park")))
+	require.Equal(t, 1, editDistance([]rune("park"), []rune("prak")))
+	require.Equal(t, 3, editDistance([]rune("kitten"), []rune("sitting")))
+}
+
+func TestSanitizeSegment(t *testing.T) {
+	s, err := SanitizeSegment("  Central Park   Fountain ")
+	require.NoError(t, err)
+	require.Equal(t, "Central-Park-Fountain", s)
+
+	_, err = SanitizeSegment("Central_Park")
+	require.ErrorIs(t, err, ErrDelimiter)
+
+	s, err = SanitizeSegmentWith("  Central Park   Fountain ", "")
+	require.NoError(t, err)
+	require.Equal(t, "CentralParkFountain", s)
+
+	s, err = SanitizeSegmentWith("Central Park", ".")
+	require.NoError(t, err)
+	require.Equal(t, "Central.Park", s)
+}
+
+func TestValidateSpaceChar(t *testing.T) {
+	require.NoError(t, ValidateSpaceChar("-"))
+	require.NoError(t, ValidateSpaceChar(""))
+	require.NoError(t, ValidateSpaceChar("."))
+	require.ErrorContains(t, ValidateSpaceChar("_"), "field delimiter")
+	require.Error(t, ValidateSpaceChar("--"))
+	require.Error(t, ValidateSpaceChar(" "))
+	require.Error(t, ValidateSpaceChar("/"))
+}
+
+func TestCheckBuiltin(t *testing.T) {
+	reset := setEnv("UCS_CSV_FILE", filepath.Join("testdata", "override.csv"))
+	t.Cleanup(reset)
+
+	require.NoError(t, CheckBuiltin(), "override is ignored")
+}
+
+func TestCheckCSV(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		csv  string
+		err  string
+	}{
+		{
+			name: "valid",
+			csv:  "AIR,BLOW,AIRBlow,AIR,,\nAIR,HISS,AIRHiss,AIR,,\n",
+		},
+		{
+			name: "out of order rows are accepted",
+			csv:  "AIR,HISS,AIRHiss,AIR,,\nAIR,BLOW,AIRBlow,AIR,,\n",
+		},
+		{
+			name: "wrong column count",
+			csv:  "AIR,BLOW,AIRBlow,AIR,,\nAIR,HISS,AIRHiss,AIR\n",
+			err:  "test.csv:2: expected 6 columns, found 4",
+		},
+		{
+			name: "empty CatID",
+			csv:  "AIR,BLOW,,AIR,,\n",
+			err:  "test.csv:1: CatID is empty",
+		},
+		{
+			name: "duplicate CatID",
+			csv:  "AIR,BLOW,AIRBlow,AIR,,\nAIR,HISS,AIRHiss,AIR,,\nAIR,PUFF,AIRBlow,AIR,,\n",
+			err:  "test.csv:3: duplicate CatID AIRBlow, first on line 1",
+		},
+		{
+			name: "empty",
+			csv:  "",
+			err:  "test.csv contains no categories",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkCSV(strings.NewReader(tt.csv), "test.csv")
+			if tt.err == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.EqualError(t, err, tt.err)
+		})
+	}
+}
+
+func TestLookup(t *testing.T) {
+	c, err := Lookup("AMBPark")
+	require.NoError(t, err)
+	require.Equal(t, "PARK", c.SubCategory)
+
+	_, err = Lookup("NOPEnope")
+	require.ErrorContains(t, err, "unknown CatID")
+}
+
+func TestFolderFor(t *testing.T) {
+	category, catShort, err := FolderFor("AMBPark")
+	require.NoError(t, err)
+	require.Equal(t, "AMBIENCE", category)
+	require.Equal(t, "AMB", catShort)
+
+	_, _, err = FolderFor("NOPEnope")
+	require.Error(t, err)
+
+	path := filepath.Join(t.TempDir(), "custom.csv")
+	require.NoError(t, os.WriteFile(path, []byte("AIR,BLOW,AIRBlow,,Air blowing,blow\n"), 0o644))
+	reset := setEnv("UCS_CSV_FILE", path)
+	t.Cleanup(reset)
+
+	_, _, err = FolderFor("AIRBlow")
+	require.EqualError(t, err, "CatID AIRBlow has no CatShort to name its folder after")
+}
+
+func TestCategoriesStableOrder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "custom.csv")
+	csv := "AIR,SECOND,AIRBlow,AIR,,\nAIR,HISS,AIRHiss,AIR,,\nAIR,FIRST,AIRBlow,AIR,,\nAIR,THIRD,AIRBlow,AIR,,\n"
+	require.NoError(t, os.WriteFile(path, []byte(csv), 0o644))
+	reset := setEnv("UCS_CSV_FILE", path)
+	t.Cleanup(reset)
+
+	categories, err := Categories()
+	require.NoError(t, err)
+	var subs []string
+	for _, c := range categories {
+		subs = append(subs, c.SubCategory)
+	}
+	require.Equal(t, []string{"SECOND", "FIRST", "THIRD", "HISS"}, subs, "a shared CatID keeps file order")
+}
+
+func TestAppendCategory(t *testing.T) {
+	reset := setEnv("UCS_CATEGORIES_FILE", filepath.Join("testdata", "override.json"))
+	t.Cleanup(reset)
+	_, err := AppendCategory(Category{Category: "AIR", SubCategory: "HISS", CatID: "AIRHiss", CatShort: "AIR"})
+	require.ErrorContains(t, err, "categories can only be added to CSV files")
+	reset()
+
+	path := filepath.Join(t.TempDir(), "custom.csv")
+	require.NoError(t, os.WriteFile(path, []byte("AIR,BLOW,AIRBlow,AIR,,,AIRWhoosh\n"), 0o644))
+	reset = setEnv("UCS_CSV_FILE", path)
+	t.Cleanup(reset)
+
+	_, err = LoadIndex()
+	require.NoError(t, err)
+
+	_, err = AppendCategory(Category{Category: "AIR", SubCategory: "HISS", CatID: "AIRHiss"})
+	require.EqualError(t, err, "CatShort is required")
+	_, err = AppendCategory(Category{Category: "AIR", SubCategory: "BLOW", CatID: "AIRBLOW", CatShort: "AIR"})
+	require.EqualError(t, err, path+": CatID AIRBlow already exists")
+	_, err = AppendCategory(Category{Category: "AIR", SubCategory: "WHOOSH", CatID: "AIRWhoosh", CatShort: "AIR"})
+	require.EqualError(t, err, path+": AIRWhoosh is already an alias of AIRBlow")
+
+	got, err := AppendCategory(Category{Category: "AIR", SubCategory: "HISS", CatID: "AIRHiss", CatShort: "AIR"})
+	require.NoError(t, err)
+	require.Equal(t, path, got)
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "AIR,BLOW,AIRBlow,AIR,,,AIRWhoosh\nAIR,HISS,AIRHiss,AIR,,,\n", string(b))
+
+	_, err = Lookup("AIRHiss")
+	require.NoError(t, err, "the cached index is dropped")
+}
+
+func TestChecksumPinning(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "custom.csv")
+	require.NoError(t, os.WriteFile(path, []byte("AIR,BLOW,AIRBlow,AIR,,\n"), 0o644))
+	reset := setEnv("UCS_CSV_FILE", path)
+	t.Cleanup(reset)
+
+	name, sum, err := Checksum()
+	require.NoError(t, err)
+	require.Equal(t, path, name)
+	require.Len(t, sum, 64)
+
+	reset = setEnv("UCS_CSV_SHA256", strings.ToUpper(sum))
+	t.Cleanup(reset)
+	categories, err := Categories()
+	require.NoError(t, err)
+	require.Len(t, categories, 1)
+
+	require.NoError(t, os.WriteFile(path, []byte("AIR,BLOW,AIRBlow,AIR,,\nAIR,HISS,AIRHiss,AIR,,\n"), 0o644))
+	_, err = Categories()
+	require.ErrorContains(t, err, "but UCS_CSV_SHA256 expects "+strings.ToUpper(sum))
+	require.ErrorContains(t, EachCategory(func(Category) error { return nil }), "UCS_CSV_SHA256")
+}
+
+func TestValidCatIDFormat(t *testing.T) {
+	require.True(t, ValidCatIDFormat("AMBPark"))
+	require.True(t, ValidCatIDFormat("RAIN"))
+	require.False(t, ValidCatIDFormat(""))
+	require.False(t, ValidCatIDFormat("ambPark"))
+	require.False(t, ValidCatIDFormat("AMB Park"))
+	require.False(t, ValidCatIDFormat("AMB_Park"))
+
+	categories, err := Categories()
+	require.NoError(t, err)
+	for _, c := range categories {
+		require.True(t, ValidCatIDFormat(c.CatID), c.CatID)
+	}
+}
+
+func TestJSONCategories(t *testing.T) {
+	reset := setEnv("UCS_CATEGORIES_FILE", filepath.Join("testdata", "override.json"))
+	t.Cleanup(reset)
+
+	categories, err := Categories()
+	require.NoError(t, err)
+	require.Equal(t, []Category{{
+		Category:    "AIR",
+		SubCategory: "BLOW",
+		CatID:       "AIRBlow",
+		CatShort:    "AIR",
+		Synonyms:    "compressed air, depressurise, release, puff, sputter, flutter, purge",
+		SynonymList: []string{"compressed air", "depressurise", "release", "puff", "sputter", "flutter", "purge"},
+	}}, categories)
+}
+
+func TestCategoriesUnsorted(t *testing.T) {
+	unsorted, err := CategoriesUnsorted()
+	require.NoError(t, err)
+	require.Equal(t, "AIRBlow", unsorted[0].CatID, "file order")
+
+	sorted, err := Categories()
+	require.NoError(t, err)
+	require.ElementsMatch(t, sorted, unsorted)
+}
+
+func TestOverrideDirectory(t *testing.T) {
+	reset := setEnv("UCS_CSV_FILE", t.TempDir())
+	t.Cleanup(reset)
+
+	_, err := Categories()
+	require.EqualError(t, err, "UCS_CSV_FILE is a directory")
+}
+
+func TestWriteCSV(t *testing.T) {
+	categories, err := CategoriesUnsorted()
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteCSV(&buf, categories))
+
+	roundTripped, warnings, err := CategoriesFrom(&buf)
+	require.NoError(t, err)
+	require.Empty(t, warnings)
+	require.Equal(t, categories, roundTripped)
+	require.NotEmpty(t, roundTripped[0].Explanations)
+}
+
+func TestAliases(t *testing.T) {
+	reset := setEnv("UCS_CSV_FILE", filepath.Join("testdata", "aliases.csv"))
+	t.Cleanup(reset)
+
+	categories, err := Categories()
+	require.NoError(t, err)
+	require.Len(t, categories, 2, "aliases aren't separate categories")
+	require.Equal(t, []string{"whoosh", "blow"}, categories[0].Aliases)
+	require.Empty(t, categories[1].Aliases)
+
+	c, err := Lookup("blow")
+	require.NoError(t, err)
+	require.Equal(t, "AIRBlow", c.CatID)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteCSV(&buf, categories))
+	require.Contains(t, buf.String(), ",whoosh:blow\n")
+}
+
+func TestCanonicalCatID(t *testing.T) {
+	catID, ok, err := CanonicalCatID("AMBPark")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "AMBPark", catID)
+
+	catID, ok, err = CanonicalCatID("ambpark")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "AMBPark", catID)
+
+	_, ok, err = CanonicalCatID("AMBNope")
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+func TestSplitSynonyms(t *testing.T) {
+	require.Equal(t, []string{"rain", "drizzle"}, splitSynonyms("rain, drizzle, "))
+	require.Empty(t, splitSynonyms(""))
+	require.Empty(t, splitSynonyms(" , "))
+}
+
+func TestSortByName(t *testing.T) {
+	list := []Category{
+		{Category: "ZOO", SubCategory: "MISC", CatID: "ZOOMisc"},
+		{Category: "ÉQUIPEMENT", SubCategory: "MISC", CatID: "EQPMisc"},
+		{Category: "EAU", SubCategory: "VAGUE", CatID: "EAUVague"},
+		{Category: "EAU", SubCategory: "ÉCLABOUSSURE", CatID: "EAUEcl"},
+	}
+	SortByName(list, language.French)
+
+	var ids []string
+	for _, c := range list {
+		ids = append(ids, c.CatID)
+	}
+	require.Equal(t, []string{"EAUEcl", "EAUVague", "EQPMisc", "ZOOMisc"}, ids)
+}
+
+func TestRoundTrip(t *testing.T) {
+	f := Filename{
+		CatID:     "AMBPark",
+		FXName:    "Fountain-Close-Wet",
+		CreatorID: "Buddin",
+		SourceID:  "Phonogrifter",
+		UserData:  "close-wet-take2",
+	}
+	parsed, err := RoundTrip(f, ".wav")
+	require.NoError(t, err)
+	require.Equal(t, f, parsed)
+
+	_, err = RoundTrip(Filename{CatID: "AMBPark", FXName: "Fountain"}, ".wav")
+	require.Error(t, err, "missing required fields")
+
+	// An empty CreatorID keeps its position, so SourceID and UserData aren't read back in its place.
+	noCreator := Filename{CatID: "AMBPark", FXName: "Fountain", SourceID: "Phono", UserData: "close"}
+	require.Equal(t, "AMBPark_Fountain__Phono_close.wav", noCreator.Render(".wav"))
+	_, err = RoundTrip(noCreator, ".wav")
+	require.ErrorContains(t, err, "CreatorID is required")
+	require.Equal(t, "AMBPark_Fountain_Buddin.wav", Filename{CatID: "AMBPark", FXName: "Fountain", CreatorID: "Buddin"}.Render(".wav"))
+
+	// Every Filename built from sanitized segments must survive a round trip.
+	rng := rand.New(rand.NewSource(1))
+	words := []string{"door", "Slam", "wet", "take 2", "  close  mic ", "v1.2", "ÉCLAT", "x"}
+	segment := func() string {
+		var parts []string
+		for i := rng.Intn(3); i >= 0; i-- {
+			parts = append(parts, words[rng.Intn(len(words))])
+		}
+		s, err := SanitizeSegment(strings.Join(parts, " "))
+		require.NoError(t, err)
+		return s
+	}
+	for i := 0; i < 500; i++ {
+		f := Filename{
+			CatID:     "AMBPark",
+			FXName:    segment(),
+			CreatorID: segment(),
+			SourceID:  segment(),
+		}
+		if rng.Intn(2) == 0 {
+			f.UserData = segment()
+		}
+		ext := []string{".wav", ".WAV", ".flac"}[rng.Intn(3)]
+		parsed, err := RoundTrip(f, ext)
+		require.NoError(t, err, f.Render(ext))
+		require.Equal(t, f, parsed)
+	}
+}
+
+func TestCategoriesFrom(t *testing.T) {
+	categories, warnings, err := CategoriesFrom(strings.NewReader(
+		"AIR,BLOW,AIRBlow,AIR,Steady air blows.,puff\n" +
+			"AIR,BURST,AIRBrst\n" +
+			"\n" +
+			"AIR,HISS,AIRHiss,AIR,Slow air releases.,leak\n" +
+			"AIR,MISC,AIRMisc,AIR,Other,misc,alias,extra\n",
+	))
+	require.NoError(t, err)
+	require.Len(t, categories, 2)
+	require.Equal(t, []ParseWarning{
+		{Line: 2, Message: "expected 6 or 7 columns, found 3"},
+		{Line: 5, Message: "expected 6 or 7 columns, found 8"},
+	}, warnings)
+	require.Equal(t, "line 2: expected 6 or 7 columns, found 3", warnings[0].String())
+
+	_, _, err = CategoriesFrom(strings.NewReader("AIR,\"BLOW,AIRBlow\n"))
+	require.Error(t, err)
+}
+
+func TestAffix(t *testing.T) {
+	a := Affix{Prefix: "PROJ-", Suffix: "-v2"}
+	require.NoError(t, a.Validate())
+	f := Filename{CatID: "AMBPark", FXName: "Fountain", CreatorID: "Buddin", SourceID: "Phonogrifter"}
+
+	name := a.Render(f, ".wav")
+	require.Equal(t, "PROJ-AMBPark_Fountain_Buddin_Phonogrifter-v2.wav", name)
+	parsed, ext, err := a.Parse(name)
+	require.NoError(t, err)
+	require.Equal(t, f, parsed)
+	require.Equal(t, ".wav", ext)
+
+	_, _, err = a.Parse("AMBPark_Fountain_Buddin_Phonogrifter.wav")
+	require.ErrorContains(t, err, "prefix")
+	require.ErrorIs(t, Affix{Prefix: "PROJ_"}.Validate(), ErrDelimiter)
+	require.Equal(t, f.Render(".wav"), Affix{}.Render(f, ".wav"))
+}
+
+func TestIndex(t *testing.T) {
+	categories, err := Categories()
+	require.NoError(t, err)
+	idx := NewIndex(categories)
+
+	c, ok := idx.Lookup("AMBPark")
+	require.True(t, ok)
+	require.Equal(t, "AMBPark", c.CatID)
+	_, ok = idx.Lookup("ambpark")
+	require.False(t, ok, "lookups are exact")
+
+	catID, ok := idx.Canonical("ambpark")
+	require.True(t, ok)
+	require.Equal(t, "AMBPark", catID)
+
+	loaded, err := LoadIndex()
+	require.NoError(t, err)
+	again, err := LoadIndex()
+	require.NoError(t, err)
+	require.Same(t, loaded, again, "the index is reused")
+
+	reset := setEnv("UCS_CSV_FILE", filepath.Join("testdata", "aliases.csv"))
+	t.Cleanup(reset)
+	overridden, err := LoadIndex()
+	require.NoError(t, err)
+	require.NotSame(t, loaded, overridden, "changing the datasource rebuilds the index")
+}
+
+func BenchmarkLookup(b *testing.B) {
+	categories, err := Categories()
+	require.NoError(b, err)
+	catIDs := make([]string, len(categories))
+	for i, c := range categories {
+		catIDs[i] = c.CatID
+	}
+
+	b.Run("linear", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			catID := catIDs[i%len(catIDs)]
+			if slices.IndexFunc(categories, func(c Category) bool { return c.CatID == catID }) < 0 {
+				b.Fatal("not found")
+			}
+		}
+	})
+	b.Run("index", func(b *testing.B) {
+		idx := NewIndex(categories)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, ok := idx.Lookup(catIDs[i%len(catIDs)]); !ok {
+				b.Fatal("not found")
+			}
+		}
+	})
+}
+
+func TestWriteFeed(t *testing.T) {
+	reset := setEnv("UCS_CSV_FILE", filepath.Join("testdata", "aliases.csv"))
+	t.Cleanup(reset)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteFeed(&buf))
+	require.Equal(t, "AIRBlow: AIR BLOW -- compressed air, depressurise, release, puff, sputter, flutter, purge (aliases: whoosh, blow)\n"+
+		"AIRHiss: AIR HISS -- air release, exhaust, expel, leak\n", buf.String())
+}
+
+func TestUserCategories(t *testing.T) {
+	list, err := UserCategoriesFrom(strings.NewReader("UserCategory,Description\nDusk,Evening ambiences\nNight\n"))
+	require.NoError(t, err)
+	require.Equal(t, []UserCategory{{Name: "Dusk", Description: "Evening ambiences"}, {Name: "Night"}}, list)
+
+	_, err = UserCategoriesFrom(strings.NewReader("Dusk\nLate_Night\n"))
+	require.ErrorContains(t, err, "line 2")
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteUserCategoryFeed(&buf, list))
+	require.Equal(t, "Dusk: Evening ambiences\nNight: \n", buf.String())
+
+	f := Filename{CatID: "AMBPark", UserCategory: "Dusk", FXName: "Fountain", CreatorID: "Buddin", SourceID: "Phonogrifter"}
+	require.Equal(t, "AMBPark-Dusk_Fountain_Buddin_Phonogrifter.wav", f.Render(".wav"))
+	parsed, err := RoundTrip(f, ".wav")
+	require.NoError(t, err)
+	require.Equal(t, "Dusk", parsed.UserCategory)
+}
+
+func TestIndexFilename(t *testing.T) {
+	idx := NewIndex([]Category{{CatID: "AMBPark", Category: "AMBIENCE", SubCategory: "PARK"}})
+	f, err := idx.Filename("ambpark")
+	require.NoError(t, err)
+	require.Equal(t, "AMBPark", f.CatID)
+	require.Equal(t, "PARK", f.Category.SubCategory)
+
+	_, err = idx.Filename("AMBPrak")
+	require.ErrorContains(t, err, `unknown CatID "AMBPrak"`)
+
+	f.FXName, f.CreatorID, f.SourceID = "Fountain", "Buddin", "Phonogrifter"
+	require.Equal(t, "AMBPark_Fountain_Buddin_Phonogrifter.wav", f.Render(".wav"))
+	_, err = RoundTrip(f, ".wav")
+	require.NoError(t, err)
+
+	b, err := json.Marshal(f)
+	require.NoError(t, err)
+	require.NotContains(t, string(b), "PARK", "omitted by default")
+
+	b, err = json.Marshal(f.WithCategory())
+	require.NoError(t, err)
+	require.Contains(t, string(b), `"category":{"category":"AMBIENCE","subCategory":"PARK"`)
+	require.Contains(t, string(b), `"CatID":"AMBPark"`)
+}
+
+func TestFilenameWriteTo(t *testing.T) {
+	for _, f := range []Filename{
+		{CatID: "AMBPark", FXName: "Fountain", CreatorID: "Buddin", SourceID: "Phonogrifter"},
+		{CatID: "AMBPark", UserCategory: "Dusk", FXName: "Fountain", CreatorID: "Buddin", SourceID: "Phonogrifter", UserData: "close"},
+	} {
+		var buf bytes.Buffer
+		n, err := f.WriteTo(&buf, ".wav")
+		require.NoError(t, err)
+		require.Equal(t, f.Render(".wav"), buf.String())
+		require.Equal(t, int64(len(f.Render(".wav"))), n)
+	}
+}
+
+func TestBracketUserCategory(t *testing.T) {
+	f, ext, err := Parse("[Dusk]AMBPark_Fountain_Buddin_Phonogrifter.wav")
+	require.NoError(t, err)
+	require.Equal(t, ".wav", ext)
+	require.Equal(t, Filename{
+		CatID:               "AMBPark",
+		UserCategory:        "Dusk",
+		BracketUserCategory: true,
+		FXName:              "Fountain",
+		CreatorID:           "Buddin",
+		SourceID:            "Phonogrifter",
+	}, f)
+	require.Equal(t, "[Dusk]AMBPark_Fountain_Buddin_Phonogrifter.wav", f.Render(".wav"))
+	_, err = RoundTrip(f, ".wav")
+	require.NoError(t, err)
+
+	f.BracketUserCategory = false
+	require.Equal(t, "AMBPark-Dusk_Fountain_Buddin_Phonogrifter.wav", f.Render(".wav"))
+
+	f, _, err = Parse("AMBPark_Fountain_Buddin_Phonogrifter.wav")
+	require.NoError(t, err)
+	require.False(t, f.BracketUserCategory)
+	require.Equal(t, "AMBPark_Fountain_Buddin_Phonogrifter.wav", f.Render(".wav"))
+
+	_, _, err = Parse("[DuskAMBPark_Fountain_Buddin_Phonogrifter.wav")
+	require.ErrorContains(t, err, "unterminated bracket")
+}
+
+func TestRequired(t *testing.T) {
+	required, err := ParseRequired("creator, user")
+	require.NoError(t, err)
+	require.Equal(t, []string{"CatID", "FXName", "CreatorID", "UserData"}, required)
+
+	_, err = ParseRequired("cat,fx,studio")
+	require.ErrorContains(t, err, "unknown field: studio")
+
+	f := Filename{CatID: "AMBPark", FXName: "Fountain", CreatorID: "Buddin"}
+	require.ErrorContains(t, f.Validate(), "SourceID is required")
+	require.ErrorContains(t, f.ValidateRequired(required), "UserData is required")
+	f.UserData = "close"
+	require.NoError(t, f.ValidateRequired(required))
+
+	require.Equal(t, "AMBPark_Fountain_Buddin__close.wav", f.Render(".wav"), "the empty SourceID keeps its place")
+	var buf bytes.Buffer
+	_, err = f.WriteTo(&buf, ".wav")
+	require.NoError(t, err)
+	require.Equal(t, f.Render(".wav"), buf.String())
+}
+
+func TestDiff(t *testing.T) {
+	old := []Category{{CatID: "AIRBlow"}, {CatID: "AMBPark"}, {CatID: "AIRHiss"}}
+	new := []Category{{CatID: "AMBPark"}, {CatID: "ZZZCustom"}, {CatID: "AAACustom"}}
+	d := Diff(old, new)
+	require.Equal(t, []Category{{CatID: "AAACustom"}, {CatID: "ZZZCustom"}}, d.Added)
+	require.Equal(t, []Category{{CatID: "AIRBlow"}, {CatID: "AIRHiss"}}, d.Removed)
+
+	builtin, err := BuiltinCategories()
+	require.NoError(t, err)
+	custom, err := CategoriesFile("testdata/aliases.csv")
+	require.NoError(t, err)
+	d = Diff(builtin, custom)
+	require.Empty(t, d.Added)
+	require.Len(t, d.Removed, len(builtin)-2)
+}
+
+func TestFingerprintName(t *testing.T) {
+	near, _, err := Parse("AMBPark_Fountain_Buddin_Field_close.wav")
+	require.NoError(t, err)
+	far, _, err := Parse("AMBPark_Fountain_Buddin_Field_far.flac")
+	require.NoError(t, err)
+	require.Equal(t, FingerprintName(near), FingerprintName(far))
+	require.Len(t, FingerprintName(near), 32)
+
+	other := near
+	other.FXName = "Fountain Splash"
+	require.NotEqual(t, FingerprintName(near), FingerprintName(other))
+
+	// Fields are separated, so moving text between them changes the fingerprint.
+	a := Filename{CatID: "AMBPark", FXName: "AB", CreatorID: "C"}
+	b := Filename{CatID: "AMBPark", FXName: "A", CreatorID: "BC"}
+	require.NotEqual(t, FingerprintName(a), FingerprintName(b))
+}
+
+func TestSetCategorySource(t *testing.T) {
+	calls := 0
+	SetCategorySource(CategorySourceFunc(func() ([]Category, error) {
+		calls++
+		return []Category{
+			{Category: "ZAP", SubCategory: "LASER", CatID: "ZAPLaser", CatShort: "ZAP", Synonyms: "pew"},
+			{Category: "AIR", SubCategory: "BLOW", CatID: "AIRBlow", CatShort: "AIR"},
+		}, nil
+	}))
+	t.Cleanup(func() { SetCategorySource(nil) })
+
+	categories, err := Categories()
+	require.NoError(t, err)
+	require.Equal(t, "AIRBlow", categories[0].CatID, "sorted by CatID")
+
+	c, err := Lookup("ZAPLaser")
+	require.NoError(t, err)
+	require.Equal(t, "LASER", c.SubCategory)
+	_, err = Lookup("AMBPark")
+	require.Error(t, err, "the builtin categories aren't consulted")
+	_, err = Lookup("AIRBlow")
+	require.NoError(t, err)
+
+	matches, err := Search("pew")
+	require.NoError(t, err)
+	require.Len(t, matches, 1)
+
+	n := 0
+	require.NoError(t, EachCategory(func(Category) error { n++; return nil }))
+	require.Equal(t, 2, n)
+
+	calls = 0
+	_, err = LoadIndex()
+	require.NoError(t, err)
+	require.Zero(t, calls, "the index is cached")
+
+	SetCategorySource(nil)
+	_, err = Lookup("AMBPark")
+	require.NoError(t, err)
+}
@@ -0,0 +1,97 @@
+package ucs
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// UserCategory is an entry of a team's own taxonomy layered on top of UCS. It's appended to the CatID
+// of a filename, separated by a dash (e.g. AMBPark-Dusk).
+type UserCategory struct {
+	Name        string
+	Description string
+}
+
+// UserCategories loads the UserCategory taxonomy from the CSV file named by UCS_USER_CATEGORY_FILE.
+// Each row holds a name, optionally followed by a description; a first row starting with
+// "UserCategory" is treated as a header. No categories, and no error, are returned when the variable
+// isn't set.
+func UserCategories() ([]UserCategory, error) {
+	path := os.Getenv("UCS_USER_CATEGORY_FILE")
+	if path == "" {
+		return nil, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("UCS_USER_CATEGORY_FILE: %w", err)
+	}
+	defer f.Close()
+
+	list, err := UserCategoriesFrom(f)
+	if err != nil {
+		return nil, fmt.Errorf("UCS_USER_CATEGORY_FILE: %w", err)
+	}
+	return list, nil
+}
+
+// UserCategoriesFrom reads a UserCategory CSV from src. See UserCategories for the format.
+func UserCategoriesFrom(src io.Reader) ([]UserCategory, error) {
+	reader := csv.NewReader(src)
+	reader.FieldsPerRecord = -1
+	var list []UserCategory
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		name := strings.TrimSpace(record[0])
+		if line == 1 && strings.EqualFold(name, "UserCategory") {
+			continue
+		}
+		if len(record) > 2 {
+			return nil, fmt.Errorf("line %d: expected 1 or 2 columns, found %d", line, len(record))
+		}
+		if err := validUserCategory(name); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		uc := UserCategory{Name: name}
+		if len(record) == 2 {
+			uc.Description = strings.TrimSpace(record[1])
+		}
+		list = append(list, uc)
+	}
+	return list, nil
+}
+
+func validUserCategory(name string) error {
+	if name == "" {
+		return fmt.Errorf("UserCategory is empty")
+	}
+	if strings.ContainsAny(name, "_ ") {
+		return fmt.Errorf("UserCategory %q can't contain underscores or spaces", name)
+	}
+	return nil
+}
+
+// WriteUserCategoryFeed writes the UserCategory taxonomy in the format consumed by fzf, one entry per
+// line:
+//
+//	Name: Description
+//
+// Like WriteFeed, the name is followed by FeedDelimiter so the selection can be parsed back.
+func WriteUserCategoryFeed(w io.Writer, list []UserCategory) error {
+	for _, uc := range list {
+		if _, err := fmt.Fprintf(w, "%s%s %s\n", uc.Name, FeedDelimiter, uc.Description); err != nil {
+			return err
+		}
+	}
+	return nil
+}